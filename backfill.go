@@ -0,0 +1,226 @@
+package firestorm
+
+import (
+	"context"
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// Backfill creates the index keys of the entities that are already stored,
+// for instance after a new index is added to an existing kind
+type Backfill struct {
+	// Client is the datastore client
+	Client *datastore.Client
+	// Engine defines the indexes. It defaults to the default engine.
+	Engine *Engine
+	// Kind is the kind of the entities
+	Kind string
+	// Prototype is an entity of the type that defines the indexes
+	Prototype interface{}
+	// Index restricts the backfill to the index with the name
+	Index string
+	// BatchSize is the number of the entities indexed between checkpoints.
+	// Their index keys are written in transactions of at most MaxMutations
+	// mutations.
+	BatchSize int
+	// Checkpoint is called with the progress after every batch. Persist the
+	// checkpoint to resume the backfill after a failure.
+	Checkpoint func(ctx context.Context, checkpoint *BackfillCheckpoint) error
+}
+
+// BackfillCheckpoint represents the progress of a backfill
+type BackfillCheckpoint struct {
+	// Cursor is the cursor after the last indexed batch
+	Cursor string
+	// Entities is the number of the scanned entities
+	Entities int
+	// Indexed is the number of the written index keys
+	Indexed int
+	// Duplicates are the unique values that are owned by more than one entity.
+	// Their index keys are not created. The values of the index keys created
+	// by older versions are reported with a nil owner, since it is unknown.
+	Duplicates []*IndexConflictError
+	// Done is true when all entities are scanned
+	Done bool
+}
+
+// Run runs the backfill from the checkpoint. A nil checkpoint starts the
+// backfill from the first entity. The index keys that already exist are kept,
+// so a batch can be indexed again after a failure.
+func (b *Backfill) Run(ctx context.Context, checkpoint *BackfillCheckpoint) (*BackfillCheckpoint, error) {
+	if _, err := entityTypeOf(b.Prototype); err != nil {
+		return nil, err
+	}
+
+	if checkpoint == nil {
+		checkpoint = &BackfillCheckpoint{}
+	}
+
+	var (
+		progress = *checkpoint
+		size     = b.BatchSize
+	)
+
+	if size <= 0 {
+		size = 100
+	}
+
+	for !progress.Done {
+		condition := &Query{Cursor: progress.Cursor, Limit: size}
+
+		query, err := condition.Build(datastore.NewQuery(b.Kind))
+		if err != nil {
+			return nil, err
+		}
+
+		keys, entities, cursor, err := b.page(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.index(ctx, keys, entities, &progress); err != nil {
+			return nil, err
+		}
+
+		progress.Cursor = cursor
+		progress.Entities += len(keys)
+		progress.Done = len(keys) < size
+
+		if b.Checkpoint != nil {
+			if err := b.Checkpoint(ctx, &progress); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &progress, nil
+}
+
+func (b *Backfill) engine() *Engine {
+	if b.Engine == nil {
+		return engine
+	}
+
+	return b.Engine
+}
+
+// page returns the entities of the query and the cursor after them
+func (b *Backfill) page(ctx context.Context, query *datastore.Query) ([]*datastore.Key, []reflect.Value, string, error) {
+	var (
+		kind, _  = entityTypeOf(b.Prototype)
+		keys     = []*datastore.Key{}
+		entities = []reflect.Value{}
+		iter     = b.Client.Run(ctx, query)
+	)
+
+	for {
+		entity := reflect.New(kind)
+
+		key, err := iter.Next(entity.Interface())
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		keys = append(keys, key)
+		entities = append(entities, entity)
+	}
+
+	cursor, err := iter.Cursor()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return keys, entities, cursor.String(), nil
+}
+
+// index creates the index keys of the entities. The keys are written in
+// transactions of at most MaxMutations mutations.
+func (b *Backfill) index(ctx context.Context, keys []*datastore.Key, entities []reflect.Value, progress *BackfillCheckpoint) error {
+	var (
+		engine = b.engine()
+		tree   = engine.Mapper.Tree(reflect.TypeOf(b.Prototype))
+	)
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var (
+		indexKeys  = []*IndexKey{}
+		duplicates = []*IndexConflictError{}
+	)
+
+	for position, key := range keys {
+		next, err := tree.KeysOf(key, entities[position], &engine.Options)
+		if conflict, ok := err.(*IndexConflictError); ok {
+			duplicates = append(duplicates, conflict)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, indexKey := range next {
+			if b.Index == "" || indexKey.Index == b.Index {
+				indexKeys = append(indexKeys, indexKey)
+			}
+		}
+	}
+
+	for len(indexKeys) > 0 {
+		size := MaxMutations
+
+		if size > len(indexKeys) {
+			size = len(indexKeys)
+		}
+
+		if err := b.write(ctx, indexKeys[:size], progress); err != nil {
+			return err
+		}
+
+		indexKeys = indexKeys[size:]
+	}
+
+	progress.Duplicates = append(progress.Duplicates, duplicates...)
+	return nil
+}
+
+// write creates the missing index keys in a single transaction
+func (b *Backfill) write(ctx context.Context, keys []*IndexKey, progress *BackfillCheckpoint) error {
+	var (
+		indexed int
+		claimed []*IndexConflictError
+	)
+
+	_, err := b.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		// the transaction may be retried, so the conflicts are collected anew
+		claimed = []*IndexConflictError{}
+
+		changes, err := plan(tx, IndexChangeset{{Added: keys}}, &claimed)
+		if err != nil {
+			return err
+		}
+
+		if indexed = changes.Len(); indexed == 0 {
+			return nil
+		}
+
+		_, err = tx.Mutate(changes.Mutations()...)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	progress.Indexed += indexed
+	progress.Duplicates = append(progress.Duplicates, claimed...)
+	return nil
+}
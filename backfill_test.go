@@ -0,0 +1,133 @@
+package firestorm_test
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backfill", func() {
+	var (
+		ctx    context.Context
+		keys   []*datastore.Key
+		client *datastore.Client
+		job    *firestorm.Backfill
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		keys = []*datastore.Key{
+			datastore.NameKey("backfilled", "001", nil),
+			datastore.NameKey("backfilled", "002", nil),
+			datastore.NameKey("backfilled", "003", nil),
+		}
+
+		entities := []*Entity{
+			{Email: "john@example.com"},
+			{Email: "jane@example.com"},
+			{Email: "john@example.com"},
+		}
+
+		_, err = client.PutMulti(ctx, keys, entities)
+		Expect(err).NotTo(HaveOccurred())
+
+		job = &firestorm.Backfill{
+			Client:    client,
+			Kind:      "backfilled",
+			Prototype: &Entity{},
+			BatchSize: 2,
+		}
+	})
+
+	AfterEach(func() {
+		indexes, err := client.GetAll(ctx, datastore.NewQuery("backfilled_email_index").KeysOnly(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.DeleteMulti(ctx, append(indexes, keys...))).To(Succeed())
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("creates the index keys and reports the duplicates", func() {
+		checkpoints := []*firestorm.BackfillCheckpoint{}
+
+		job.Checkpoint = func(ctx context.Context, checkpoint *firestorm.BackfillCheckpoint) error {
+			current := *checkpoint
+			checkpoints = append(checkpoints, &current)
+			return nil
+		}
+
+		progress, err := job.Run(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(progress.Done).To(BeTrue())
+		Expect(progress.Entities).To(Equal(3))
+		Expect(progress.Indexed).To(Equal(2))
+		Expect(progress.Duplicates).To(HaveLen(1))
+		Expect(progress.Duplicates[0].Owner).To(Equal(keys[0]))
+		Expect(checkpoints).To(HaveLen(2))
+
+		report, err := firestorm.Verify(ctx, client, "backfilled", &Entity{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Missing).To(BeEmpty())
+	})
+
+	Context("when the index keys exceed the mutation limit", func() {
+		It("writes them in several transactions", func() {
+			accounts := []*datastore.Key{
+				datastore.NameKey("backfilled_account", "001", nil),
+				datastore.NameKey("backfilled_account", "002", nil),
+			}
+
+			entities := []*Account{{}, {}}
+
+			for index := 0; index < 300; index++ {
+				entities[0].Emails = append(entities[0].Emails, fmt.Sprintf("john%d@example.com", index))
+				entities[1].Emails = append(entities[1].Emails, fmt.Sprintf("jane%d@example.com", index))
+			}
+
+			_, err := client.PutMulti(ctx, accounts, entities)
+			Expect(err).NotTo(HaveOccurred())
+
+			job.Kind = "backfilled_account"
+			job.Prototype = &Account{}
+
+			progress, err := job.Run(ctx, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(progress.Indexed).To(Equal(600))
+
+			indexes, err := client.GetAll(ctx, datastore.NewQuery("backfilled_account_email_index").KeysOnly(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(indexes).To(HaveLen(600))
+
+			_, err = firestorm.DropIndex(ctx, client, "backfilled_account", "email")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.DeleteMulti(ctx, accounts)).To(Succeed())
+		})
+	})
+
+	Context("when the backfill resumes from a checkpoint", func() {
+		It("indexes the remaining entities", func() {
+			job.Checkpoint = func(ctx context.Context, checkpoint *firestorm.BackfillCheckpoint) error {
+				return context.Canceled
+			}
+
+			_, err := job.Run(ctx, nil)
+			Expect(err).To(Equal(context.Canceled))
+
+			job.Checkpoint = nil
+
+			progress, err := job.Run(ctx, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(progress.Entities).To(Equal(3))
+			Expect(progress.Indexed).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,259 @@
+package firestorm
+
+import (
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+)
+
+// MaxMutations is the maximum number of mutations Datastore accepts in a
+// single transaction
+const MaxMutations = 500
+
+// NewBatchInsertIndexer represents an insert indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func (e *Engine) NewBatchInsertIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	fn := func(reader Reader) (IndexChangeset, error) {
+		batch, err := e.batch(keys, entities, true)
+		if err != nil {
+			return nil, err
+		}
+
+		treeNext, err := batch.IndexKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := limit(len(treeNext)); err != nil {
+			return nil, err
+		}
+
+		return IndexChangeset{{Added: treeNext}}, nil
+	}
+
+	return writer(nil, fn)
+}
+
+// NewBatchUpdateIndexer represents an update indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func (e *Engine) NewBatchUpdateIndexer(keys []*datastore.Key, entities interface{}, options ...UpdateOption) Indexer {
+	opts := updateOptionsOf(options)
+
+	fn := func(reader Reader) (IndexChangeset, error) {
+		batch, err := e.batch(keys, entities, true)
+		if err != nil {
+			return nil, err
+		}
+
+		prev, err := batch.Load(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		for index := range prev {
+			if !prev[index].IsValid() && !opts.AllowMissing {
+				return nil, fmt.Errorf("firestorm: entity %v: %w", keys[index], datastore.ErrNoSuchEntity)
+			}
+		}
+
+		return batch.Changes(prev)
+	}
+
+	return writer(nil, fn)
+}
+
+// NewBatchUpsertIndexer represents an upsert indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func (e *Engine) NewBatchUpsertIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	return e.NewBatchUpdateIndexer(keys, entities, AllowMissing())
+}
+
+// NewBatchDeleteIndexer represents a delete indexer for multiple entities.
+// The entities must be a slice with the same length as the keys. They are
+// used to load the stored state of the entities.
+func (e *Engine) NewBatchDeleteIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	fn := func(reader Reader) (IndexChangeset, error) {
+		batch, err := e.batch(keys, entities, false)
+		if err != nil {
+			return nil, err
+		}
+
+		prev, err := batch.Load(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		removed := []*IndexKey{}
+
+		for index, entity := range prev {
+			if !entity.IsValid() {
+				continue
+			}
+
+			treePrev, err := batch.Trees[index].KeysOf(keys[index], entity, batch.Options)
+			if err != nil {
+				return nil, err
+			}
+
+			removed = append(removed, treePrev...)
+		}
+
+		if err := limit(len(removed)); err != nil {
+			return nil, err
+		}
+
+		return IndexChangeset{{Removed: removed}}, nil
+	}
+
+	return writer(nil, fn)
+}
+
+type batch struct {
+	Keys     []*datastore.Key
+	Entities []reflect.Value
+	Types    []reflect.Type
+	Trees    []*IndexTree
+	Options  *KeyOptions
+}
+
+// batch validates the keys and the entities. The entities must hold values
+// unless only their types are used.
+func (e *Engine) batch(keys []*datastore.Key, entities interface{}, values bool) (*batch, error) {
+	value := reflect.ValueOf(entities)
+
+	if value.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("firestorm: entities must be a slice, got %T", entities)
+	}
+
+	if value.Len() != len(keys) {
+		return nil, fmt.Errorf("firestorm: got %d keys and %d entities", len(keys), value.Len())
+	}
+
+	if err := limit(len(keys)); err != nil {
+		return nil, err
+	}
+
+	b := &batch{
+		Options: &e.Options,
+	}
+
+	for index, key := range keys {
+		if key == nil {
+			return nil, datastore.ErrInvalidKey
+		}
+
+		var (
+			input     = value.Index(index).Interface()
+			kind, err = entityTypeOf(input)
+			entity    = reflect.ValueOf(input)
+		)
+
+		if values && err == nil {
+			kind, entity, err = entityOf(input)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("firestorm: entity %v: %w", key, err)
+		}
+
+		b.Keys = append(b.Keys, key)
+		b.Entities = append(b.Entities, entity)
+		b.Types = append(b.Types, kind)
+		b.Trees = append(b.Trees, e.Mapper.Tree(kind))
+	}
+
+	return b, nil
+}
+
+// IndexKeys returns the index keys of all entities in the batch
+func (b *batch) IndexKeys() ([]*IndexKey, error) {
+	result := []*IndexKey{}
+
+	for index, entity := range b.Entities {
+		keys, err := b.Trees[index].KeysOf(b.Keys[index], entity, b.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, keys...)
+	}
+
+	return result, nil
+}
+
+// Load loads the stored state of the entities with a single GetMulti call.
+// The value of a missing entity is invalid.
+func (b *batch) Load(reader Reader) ([]reflect.Value, error) {
+	var (
+		prev = make([]reflect.Value, len(b.Entities))
+		dst  = make([]interface{}, len(b.Entities))
+		errs = make(datastore.MultiError, len(b.Entities))
+	)
+
+	for index, kind := range b.Types {
+		prev[index] = reflect.New(kind)
+		dst[index] = prev[index].Interface()
+	}
+
+	switch err := reader.GetMulti(b.Keys, dst).(type) {
+	case nil:
+	case datastore.MultiError:
+		errs = err
+	default:
+		return nil, err
+	}
+
+	for index, err := range errs {
+		switch {
+		case err == datastore.ErrNoSuchEntity:
+			prev[index] = reflect.Value{}
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	return prev, nil
+}
+
+// Changes returns the index changes that replace the previous index keys of
+// the entities with the next ones
+func (b *batch) Changes(prev []reflect.Value) (IndexChangeset, error) {
+	changeset := IndexChangeset{}
+
+	for index, entity := range b.Entities {
+		var (
+			key  = b.Keys[index]
+			tree = b.Trees[index]
+		)
+
+		treeNext, err := tree.KeysOf(key, entity, b.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		treePrev := []*IndexKey{}
+
+		if prev[index].IsValid() {
+			if treePrev, err = tree.KeysOf(key, prev[index], b.Options); err != nil {
+				return nil, err
+			}
+		}
+
+		changeset = append(changeset, tree.Diff(treePrev, treeNext)...)
+	}
+
+	if err := limit(len(changeset.Added()) + len(changeset.Removed())); err != nil {
+		return nil, err
+	}
+
+	return changeset, nil
+}
+
+func limit(count int) error {
+	if count > MaxMutations {
+		return fmt.Errorf("firestorm: %d mutations exceed the transaction limit of %d", count, MaxMutations)
+	}
+
+	return nil
+}
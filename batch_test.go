@@ -0,0 +1,266 @@
+package firestorm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewBatchInsertIndexer", func() {
+	var (
+		ctx      context.Context
+		keys     []*datastore.Key
+		entities []*Entity
+		client   *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entities = []*Entity{
+			{ID: datastore.NameKey("entity", "007", nil), FirstName: "John", Email: "john@example.com"},
+			{ID: datastore.NameKey("entity", "008", nil), FirstName: "Jack", Email: "jack@example.com"},
+		}
+
+		keys = []*datastore.Key{entities[0].ID, entities[1].ID}
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		query := datastore.NewQuery("entity_email_index").KeysOnly()
+
+		keys, err := client.GetAll(ctx, query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("inserts the indexes successfully", func() {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			indexer := firestorm.NewBatchInsertIndexer(keys, entities)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, entity := range entities {
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", entity.Email)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(entity.ID))
+		}
+	})
+
+	Context("when two entities claim the same value", func() {
+		BeforeEach(func() {
+			entities[1].Email = entities[0].Email
+		})
+
+		It("returns an error", func() {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewBatchInsertIndexer(keys, entities)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			conflict := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Owner).To(Equal(entities[0].ID))
+		})
+	})
+
+	Context("when the keys and entities do not match", func() {
+		It("returns an error", func() {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewBatchInsertIndexer(keys[:1], entities)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			Expect(err).To(MatchError("firestorm: got 1 keys and 2 entities"))
+		})
+	})
+
+	Context("when the batch exceeds the mutation limit", func() {
+		BeforeEach(func() {
+			keys = []*datastore.Key{}
+			entities = []*Entity{}
+
+			for index := 0; index <= firestorm.MaxMutations; index++ {
+				entity := &Entity{
+					ID:    datastore.IDKey("entity", int64(index+1), nil),
+					Email: fmt.Sprintf("user%d@example.com", index),
+				}
+
+				keys = append(keys, entity.ID)
+				entities = append(entities, entity)
+			}
+		})
+
+		It("returns an error", func() {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewBatchInsertIndexer(keys, entities)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			Expect(err).To(MatchError("firestorm: 501 mutations exceed the transaction limit of 500"))
+		})
+	})
+})
+
+var _ = Describe("NewBatchUpdateIndexer", func() {
+	var (
+		ctx      context.Context
+		keys     []*datastore.Key
+		entities []*Entity
+		client   *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entities = []*Entity{
+			{ID: datastore.NameKey("entity", "007", nil), FirstName: "John", Email: "john@example.com"},
+			{ID: datastore.NameKey("entity", "008", nil), FirstName: "Jack", Email: "jack@example.com"},
+		}
+
+		keys = []*datastore.Key{entities[0].ID, entities[1].ID}
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if _, err := tx.PutMulti(keys, entities); err != nil {
+				return err
+			}
+
+			indexer := firestorm.NewBatchInsertIndexer(keys, entities)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, kind := range []string{"entity", "entity_email_index"} {
+			query := datastore.NewQuery(kind).KeysOnly()
+
+			keys, err := client.GetAll(ctx, query, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+		}
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("updates the indexes successfully", func() {
+		entities[0].Email = "jim@example.com"
+
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			indexer := firestorm.NewBatchUpdateIndexer(keys, entities)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "jim@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(entities[0].ID))
+	})
+
+	Context("when the values are swapped", func() {
+		It("updates the indexes successfully", func() {
+			entities[0].Email = "jack@example.com"
+			entities[1].Email = "john@example.com"
+
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewBatchUpdateIndexer(keys, entities)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "jack@example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(entities[0].ID))
+		})
+	})
+
+	Context("when the value is owned by another entity", func() {
+		It("returns an error", func() {
+			entities[0].Email = entities[1].Email
+
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewBatchUpdateIndexer(keys, entities)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			conflict := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Owner).To(Equal(entities[1].ID))
+		})
+	})
+})
+
+var _ = Describe("NewBatchDeleteIndexer", func() {
+	var (
+		ctx      context.Context
+		keys     []*datastore.Key
+		entities []*Entity
+		client   *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entities = []*Entity{
+			{ID: datastore.NameKey("entity", "007", nil), FirstName: "John", Email: "john@example.com"},
+			{ID: datastore.NameKey("entity", "008", nil), FirstName: "Jack", Email: "jack@example.com"},
+		}
+
+		keys = []*datastore.Key{entities[0].ID, entities[1].ID}
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if _, err := tx.PutMulti(keys, entities); err != nil {
+				return err
+			}
+
+			indexer := firestorm.NewBatchInsertIndexer(keys, entities)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("deletes the indexes successfully", func() {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			indexer := firestorm.NewBatchDeleteIndexer(keys, []*Entity{{}, {}})
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		query := datastore.NewQuery("entity_email_index").KeysOnly()
+
+		keys, err := client.GetAll(ctx, query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(BeEmpty())
+	})
+})
@@ -0,0 +1,93 @@
+package firestorm
+
+// Chain returns an indexer that runs the indexers in order and stops at the
+// first error
+func Chain(indexers ...Indexer) Indexer {
+	fn := func(tx Transaction) error {
+		for _, indexer := range indexers {
+			if err := indexer.Index(tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return IndexerFunc(fn)
+}
+
+// Merge returns an indexer that collects the changesets of the indexers and
+// applies them with a single Apply call. The index changes of the indexers of
+// an engine are planned together, so a unique value released by one indexer
+// can be claimed by another. The other indexers apply their changesets to a
+// transaction that records them. The indexers read the stored state, so an
+// indexer does not observe the changes of the others.
+func Merge(indexers ...Indexer) Indexer {
+	return &merger{indexers: indexers}
+}
+
+// merger is the indexer returned by Merge
+type merger struct {
+	indexers []Indexer
+}
+
+// Plan returns the changeset of the merged indexers
+func (m *merger) Plan(reader Reader) (*Changeset, error) {
+	var (
+		planned  = &planner{}
+		recorder = &recorder{Reader: reader, changes: &Changeset{}}
+		queue    = append([]Indexer{}, m.indexers...)
+	)
+
+	for len(queue) > 0 {
+		indexer := queue[0]
+		queue = queue[1:]
+
+		switch part := indexer.(type) {
+		case *merger:
+			queue = append(append([]Indexer{}, part.indexers...), queue...)
+		case *planner:
+			planned.parts = append(planned.parts, part)
+		default:
+			if err := indexer.Index(recorder); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	changes, err := planned.Plan(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	changes.append(recorder.changes)
+
+	if err := limit(changes.Len()); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// Index applies the changeset of the merged indexers
+func (m *merger) Index(tx Transaction) error {
+	changes, err := m.Plan(tx)
+	if err != nil || changes.Len() == 0 {
+		return err
+	}
+
+	return tx.Apply(changes)
+}
+
+// recorder is a transaction that records the applied changesets instead of
+// applying them
+type recorder struct {
+	Reader
+	changes *Changeset
+}
+
+// Apply records the changeset
+func (r *recorder) Apply(changes *Changeset) error {
+	r.changes.append(changes)
+	return nil
+}
@@ -0,0 +1,134 @@
+package firestorm_test
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain", func() {
+	It("runs the indexers in order", func() {
+		calls := []int{}
+
+		indexer := func(position int, err error) firestorm.Indexer {
+			return firestorm.IndexerFunc(func(tx firestorm.Transaction) error {
+				calls = append(calls, position)
+				return err
+			})
+		}
+
+		tx := firestorm.NewMemory().NewTransaction()
+
+		err := firestorm.Chain(indexer(1, nil), indexer(2, fmt.Errorf("oh no")), indexer(3, nil)).Index(tx)
+		Expect(err).To(MatchError("oh no"))
+		Expect(calls).To(Equal([]int{1, 2}))
+	})
+})
+
+var _ = Describe("Merge", func() {
+	var (
+		memory *firestorm.Memory
+		john   *Entity
+		jane   *Entity
+	)
+
+	BeforeEach(func() {
+		memory = firestorm.NewMemory()
+
+		john = &Entity{
+			ID:    datastore.NameKey("entity", "007", nil),
+			Email: "john@example.com",
+		}
+
+		jane = &Entity{
+			ID:    datastore.NameKey("entity", "008", nil),
+			Email: "jane@example.com",
+		}
+	})
+
+	It("applies the mutations of all indexers", func() {
+		indexer := firestorm.Merge(
+			firestorm.NewInsertWriter(john.ID, john),
+			firestorm.NewInsertWriter(jane.ID, jane),
+		)
+
+		changes, err := firestorm.Plan(memory.NewTransaction(), indexer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Len()).To(Equal(4))
+
+		Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+		Expect(memory.Get(john.ID, &Entity{})).To(Succeed())
+		Expect(memory.Get(jane.ID, &Entity{})).To(Succeed())
+	})
+
+	Context("when an indexer claims the value another one releases", func() {
+		It("moves the value to the other owner", func() {
+			Expect(memory.RunInTransaction(firestorm.NewInsertWriter(john.ID, john).Index)).To(Succeed())
+			Expect(memory.RunInTransaction(firestorm.NewInsertWriter(jane.ID, jane).Index)).To(Succeed())
+
+			jane.Email = john.Email
+			john.Email = "jd@example.com"
+
+			indexer := firestorm.Merge(
+				firestorm.NewUpdateWriter(john.ID, john),
+				firestorm.NewUpdateWriter(jane.ID, jane),
+			)
+
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+
+			key := &firestorm.IndexKey{}
+			Expect(memory.Get(datastore.NameKey("entity_email_index", "14491862341308332741", nil), key)).To(Succeed())
+			Expect(key.Owner).To(Equal(jane.ID))
+		})
+	})
+
+	Context("when the indexers are not planners", func() {
+		It("applies their changesets with the others", func() {
+			audit := datastore.NameKey("audit", "007", nil)
+
+			custom := firestorm.IndexerFunc(func(tx firestorm.Transaction) error {
+				return tx.Apply(&firestorm.Changeset{
+					Entities: []*firestorm.EntityMutation{
+						{Operation: firestorm.InsertOperation, Key: audit, Entity: &Audit{CreatedBy: "john"}},
+					},
+				})
+			})
+
+			indexer := firestorm.Merge(
+				firestorm.NewInsertWriter(john.ID, john),
+				firestorm.Chain(firestorm.NewInsertWriter(jane.ID, jane), custom),
+			)
+
+			changes, err := firestorm.Plan(memory.NewTransaction(), indexer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Entities).To(HaveLen(3))
+			Expect(changes.Insert).To(HaveLen(2))
+
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+			Expect(memory.Get(jane.ID, &Entity{})).To(Succeed())
+			Expect(memory.Get(audit, &Audit{})).To(Succeed())
+		})
+	})
+
+	Context("when the indexers claim the same unique value", func() {
+		It("returns a conflict error", func() {
+			jane.Email = john.Email
+
+			indexer := firestorm.Merge(
+				firestorm.NewInsertIndexer(john.ID, john),
+				firestorm.NewInsertIndexer(jane.ID, jane),
+			)
+
+			err := memory.RunInTransaction(indexer.Index)
+
+			conflict := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Owner).To(Equal(john.ID))
+		})
+	})
+})
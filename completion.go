@@ -33,5 +33,6 @@ func (k *Completion) LoadKey(ctx context.Context, entity datastore.KeyLoader) er
 		return err
 	}
 
-	return entity.LoadKey(complete[0])
+	k.Key = complete[0]
+	return entity.LoadKey(k.Key)
 }
@@ -0,0 +1,132 @@
+package firestorm
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// DropIndex deletes the entities of the index of the entity kind page by page
+// as they are queried. It returns the number of the deleted entities.
+func (e *Engine) DropIndex(ctx context.Context, client *datastore.Client, kind, name string) (int, error) {
+	return e.drop(ctx, client, kind, name, func(key *datastore.Key) bool {
+		return true
+	})
+}
+
+// DropEncoding deletes the entities of the index of the entity kind whose key
+// names are in the given encoding, so the entities of an index moved to
+// another encoding can be dropped once the new ones are backfilled. It returns
+// the number of the deleted entities.
+func (e *Engine) DropEncoding(ctx context.Context, client *datastore.Client, kind, name, encoding string) (int, error) {
+	if encoding == "" {
+		encoding = HashEncoding
+	}
+
+	prefix := e.Options.strategy().Name(kind, name, "")
+
+	return e.drop(ctx, client, kind, name, func(key *datastore.Key) bool {
+		// the non-unique index entities are children of the value
+		if isValueChild(key) {
+			key = key.Parent
+		}
+
+		return EncodingOf(strings.TrimPrefix(key.Name, prefix)) == encoding
+	})
+}
+
+// drop deletes the entities of the index that match
+func (e *Engine) drop(ctx context.Context, client *datastore.Client, kind, name string, match func(key *datastore.Key) bool) (int, error) {
+	count := 0
+
+	err := e.Options.scan(ctx, client, kind, name, "", MaxMutations, func(page []*datastore.Key) error {
+		keys := []*datastore.Key{}
+
+		for _, key := range page {
+			if match(key) {
+				keys = append(keys, key)
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		if err := client.DeleteMulti(ctx, keys); err != nil {
+			return err
+		}
+
+		count += len(keys)
+		return nil
+	})
+
+	return count, err
+}
+
+// UnknownIndexes returns the index kinds that no index of the given kinds
+// claims. The kinds map the entity kinds to their prototypes, so every live
+// kind must be passed. The index kinds are the kinds with the prefix of the
+// engine and the _index suffix of the KindKeyStrategy.
+func (e *Engine) UnknownIndexes(ctx context.Context, client *datastore.Client, kinds map[string]interface{}) ([]string, error) {
+	claimed, err := e.claimed(kinds)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		query   = datastore.NewQuery("__kind__").Namespace(e.Options.Namespace).KeysOnly()
+		unknown = []string{}
+	)
+
+	err = pages(ctx, client, query, MaxLookups, func(keys []*datastore.Key) error {
+		for _, key := range keys {
+			kind := key.Name
+
+			if !strings.HasPrefix(kind, e.Options.Prefix) || !strings.HasSuffix(kind, "_index") {
+				continue
+			}
+
+			if !claimed[kind] {
+				unknown = append(unknown, kind)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// claimed returns the index kinds of the given kinds
+func (e *Engine) claimed(kinds map[string]interface{}) (map[string]bool, error) {
+	var (
+		claimed  = make(map[string]bool)
+		strategy = e.Options.strategy()
+	)
+
+	for kind, prototype := range kinds {
+		kindOf, err := entityTypeOf(prototype)
+		if err != nil {
+			return nil, err
+		}
+
+		tree := e.Mapper.Tree(kindOf)
+
+		if tree == nil {
+			continue
+		}
+
+		for _, index := range *tree {
+			claimed[e.Options.Prefix+strategy.Kind(kind, index.Name)] = true
+		}
+	}
+
+	return claimed, nil
+}
@@ -0,0 +1,119 @@
+package firestorm_test
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DropIndex", func() {
+	var (
+		ctx    context.Context
+		engine *firestorm.Engine
+		client *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		engine = firestorm.NewEngine()
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		keys := []*datastore.Key{
+			datastore.NameKey("dropped_email_index", "001", nil),
+			datastore.NameKey("dropped_email_index", "002", nil),
+			datastore.NameKey("dropped_legacy_index", "003", nil),
+		}
+
+		_, err = client.PutMulti(ctx, keys, []*firestorm.IndexKey{{}, {}, {}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, name := range []string{"email", "legacy"} {
+			_, err := engine.DropIndex(ctx, client, "dropped", name)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("deletes the index entities", func() {
+		count, err := engine.DropIndex(ctx, client, "dropped", "email")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(2))
+
+		keys, err := client.GetAll(ctx, datastore.NewQuery("dropped_email_index").KeysOnly(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(BeEmpty())
+	})
+
+	Context("when the index is scoped and the strategy shares the kind", func() {
+		It("deletes the index entities under the ancestors", func() {
+			scoped := firestorm.NewEngine()
+			scoped.Options.Strategy = &firestorm.SingleKindKeyStrategy{IndexKind: "dropped_index"}
+
+			project := &Project{
+				ID:   datastore.NameKey("project", "007", datastore.NameKey("organization", "r&d", nil)),
+				Name: "firestorm",
+				Code: "fs",
+			}
+
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				return scoped.NewInsertIndexer(project.ID, project).Index(firestorm.NewTransaction(tx))
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			report, err := scoped.Verify(ctx, client, "project", &Project{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Orphaned).To(HaveLen(2))
+
+			for _, name := range []string{"name", "code"} {
+				count, err := scoped.DropIndex(ctx, client, "project", name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(count).To(Equal(1))
+			}
+
+			keys, err := client.GetAll(ctx, datastore.NewQuery("dropped_index").KeysOnly(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(BeEmpty())
+		})
+	})
+
+	Describe("DropEncoding", func() {
+		It("deletes the index entities of the encoding", func() {
+			keys := []*datastore.Key{
+				datastore.NameKey("dropped_email_index", "canonical:s\"john@example.com\"", nil),
+				datastore.NameKey("dropped_email_index", "sha256:cafe", nil),
+			}
+
+			_, err := client.PutMulti(ctx, keys, []*firestorm.IndexKey{{}, {}})
+			Expect(err).NotTo(HaveOccurred())
+
+			count, err := engine.DropEncoding(ctx, client, "dropped", "email", firestorm.HashEncoding)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(2))
+
+			stored, err := client.GetAll(ctx, datastore.NewQuery("dropped_email_index").KeysOnly(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(ConsistOf(keys))
+		})
+	})
+
+	Describe("UnknownIndexes", func() {
+		It("returns the index kinds that no given kind claims", func() {
+			kinds, err := engine.UnknownIndexes(ctx, client, map[string]interface{}{
+				"dropped": &Entity{},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kinds).To(ContainElement("dropped_legacy_index"))
+			Expect(kinds).NotTo(ContainElement("dropped_email_index"))
+		})
+	})
+})
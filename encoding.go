@@ -0,0 +1,183 @@
+package firestorm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+const (
+	// HashEncoding names the index keys with the decimal 64-bit hash of the
+	// values. It's the default encoding and the one used by the indexes
+	// created before the encodings were introduced.
+	HashEncoding = "hash"
+	// CanonicalEncoding names the index keys with a deterministic canonical
+	// encoding of the values. The names longer than MaxCanonicalLength are
+	// named with the SHA-256 digest prefixed with the canonical prefix.
+	CanonicalEncoding = "canonical"
+	// SHA256Encoding names the index keys with the SHA-256 digest of the
+	// canonical encoding of the values.
+	SHA256Encoding = "sha256"
+)
+
+// MaxCanonicalLength is the maximum length of a canonical index key name
+const MaxCanonicalLength = 500
+
+const (
+	canonicalPrefix = "canonical:"
+	sha256Prefix    = "sha256:"
+)
+
+// Encode returns the index key name of the values in the given encoding. An
+// empty encoding is the HashEncoding.
+//
+// The names of the different encodings never overlap. The canonical and the
+// SHA-256 names are prefixed with the encoding name, while the hash names
+// are plain decimal numbers. EncodingOf returns the encoding of a name.
+func Encode(encoding string, values []interface{}) (string, error) {
+	switch encoding {
+	case "", HashEncoding:
+		hash, err := hash(values)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%v", hash), nil
+	case CanonicalEncoding:
+		name, err := canonical(values)
+		if err != nil {
+			return "", err
+		}
+
+		if name = canonicalPrefix + name; len(name) > MaxCanonicalLength {
+			// the canonical encodings never start with the sha256 prefix
+			return canonicalPrefix + digest(name[len(canonicalPrefix):]), nil
+		}
+
+		return name, nil
+	case SHA256Encoding:
+		name, err := canonical(values)
+		if err != nil {
+			return "", err
+		}
+
+		return digest(name), nil
+	default:
+		return "", fmt.Errorf("firestorm: unknown index encoding %q", encoding)
+	}
+}
+
+// EncodingOf returns the encoding of the index key name or an empty string if
+// the name is not encoded with any of the encodings
+func EncodingOf(name string) string {
+	switch {
+	case strings.HasPrefix(name, canonicalPrefix):
+		return CanonicalEncoding
+	case strings.HasPrefix(name, sha256Prefix):
+		return SHA256Encoding
+	case name == "":
+		return ""
+	}
+
+	for _, char := range name {
+		if char < '0' || char > '9' {
+			return ""
+		}
+	}
+
+	return HashEncoding
+}
+
+func digest(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return sha256Prefix + hex.EncodeToString(sum[:])
+}
+
+func canonical(values []interface{}) (string, error) {
+	parts := []string{}
+
+	for _, value := range values {
+		part, err := canonicalOf(reflect.ValueOf(value))
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ","), nil
+}
+
+var (
+	keyType  = reflect.TypeOf(&datastore.Key{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+func canonicalOf(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "n", nil
+	}
+
+	switch v.Type() {
+	case keyType:
+		if v.IsNil() {
+			return "n", nil
+		}
+
+		return "k" + strconv.Quote(v.Interface().(*datastore.Key).String()), nil
+	case timeType:
+		return "t" + v.Interface().(time.Time).UTC().Format(time.RFC3339Nano), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "n", nil
+		}
+
+		return canonicalOf(v.Elem())
+	case reflect.String:
+		return "s" + strconv.Quote(v.String()), nil
+	case reflect.Bool:
+		return "b" + strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "i" + strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "u" + strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return "f" + strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return "x" + hex.EncodeToString(v.Bytes()), nil
+		}
+
+		parts := []string{}
+
+		for index := 0; index < v.Len(); index++ {
+			part, err := canonicalOf(v.Index(index))
+			if err != nil {
+				return "", err
+			}
+
+			parts = append(parts, part)
+		}
+
+		return "[" + strings.Join(parts, ",") + "]", nil
+	default:
+		// json encodes the maps with sorted keys and the structs with the
+		// fields in declaration order, so the result is deterministic
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return "", err
+		}
+
+		return "j" + string(data), nil
+	}
+}
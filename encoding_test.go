@@ -0,0 +1,104 @@
+package firestorm_test
+
+import (
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encode", func() {
+	It("returns the hash encoding by default", func() {
+		name, err := firestorm.Encode("", []interface{}{"john@example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("14491862341308332741"))
+
+		name, err = firestorm.Encode(firestorm.HashEncoding, []interface{}{"john@example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("14491862341308332741"))
+	})
+
+	Context("when the encoding is canonical", func() {
+		It("returns the canonical encoding", func() {
+			values := []interface{}{
+				"john@example.com",
+				42,
+				uint8(7),
+				true,
+				1.5,
+				nil,
+				firestorm.String("doe"),
+				[]string{"a", "b"},
+				[]byte{0xca, 0xfe},
+				time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				datastore.NameKey("entity", "007", nil),
+			}
+
+			name, err := firestorm.Encode(firestorm.CanonicalEncoding, values)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal(`canonical:s"john@example.com",i42,u7,btrue,f1.5,n,s"doe",[s"a",s"b"],xcafe,t2020-01-02T03:04:05Z,k"/entity,007"`))
+		})
+
+		It("distinguishes the values that look alike", func() {
+			first, err := firestorm.Encode(firestorm.CanonicalEncoding, []interface{}{"a,b", "c"})
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err := firestorm.Encode(firestorm.CanonicalEncoding, []interface{}{"a", "b,c"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(first).NotTo(Equal(second))
+		})
+
+		Context("when the encoding is too long", func() {
+			It("returns the sha256 encoding with the canonical prefix", func() {
+				values := []interface{}{strings.Repeat("x", firestorm.MaxCanonicalLength)}
+
+				name, err := firestorm.Encode(firestorm.CanonicalEncoding, values)
+				Expect(err).NotTo(HaveOccurred())
+
+				digest, err := firestorm.Encode(firestorm.SHA256Encoding, values)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(name).To(Equal("canonical:" + digest))
+				Expect(firestorm.EncodingOf(name)).To(Equal(firestorm.CanonicalEncoding))
+			})
+		})
+	})
+
+	Context("when the encoding is sha256", func() {
+		It("returns the sha256 encoding", func() {
+			name, err := firestorm.Encode(firestorm.SHA256Encoding, []interface{}{"john@example.com"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(HavePrefix("sha256:"))
+			Expect(name).To(HaveLen(len("sha256:") + 64))
+		})
+	})
+
+	Describe("EncodingOf", func() {
+		It("returns the encoding of the name", func() {
+			for _, encoding := range []string{firestorm.HashEncoding, firestorm.CanonicalEncoding, firestorm.SHA256Encoding} {
+				name, err := firestorm.Encode(encoding, []interface{}{"john@example.com"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(firestorm.EncodingOf(name)).To(Equal(encoding))
+			}
+		})
+
+		Context("when the name is not encoded", func() {
+			It("returns an empty string", func() {
+				Expect(firestorm.EncodingOf("john@example.com")).To(BeEmpty())
+				Expect(firestorm.EncodingOf("")).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when the encoding is unknown", func() {
+		It("returns an error", func() {
+			name, err := firestorm.Encode("base64", []interface{}{"john@example.com"})
+			Expect(err).To(MatchError(`firestorm: unknown index encoding "base64"`))
+			Expect(name).To(BeEmpty())
+		})
+	})
+})
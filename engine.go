@@ -0,0 +1,169 @@
+package firestorm
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+var engine = NewEngine()
+
+// Engine creates the indexers. Every engine owns its IndexMapper, so the
+// engines can have different index configurations.
+type Engine struct {
+	Mapper  *IndexMapper
+	Options KeyOptions
+}
+
+// NewEngine returns a new engine with an empty mapper
+func NewEngine() *Engine {
+	return &Engine{
+		Mapper: NewIndexMapper(),
+	}
+}
+
+// NewIndexMapper returns a new mapper
+func NewIndexMapper() *IndexMapper {
+	return &IndexMapper{
+		Mutex: &sync.Mutex{},
+		Cache: make(map[reflect.Type]*IndexTree),
+		Specs: make(map[reflect.Type][]IndexSpec),
+	}
+}
+
+// DefaultEngine returns the engine used by the package level functions
+func DefaultEngine() *Engine {
+	return engine
+}
+
+// RegisterIndex registers the index specs of the given type
+func (e *Engine) RegisterIndex(t reflect.Type, specs ...IndexSpec) {
+	e.Mapper.Register(t, specs...)
+}
+
+// RegisterIndex registers the index specs of the given type
+func RegisterIndex(t reflect.Type, specs ...IndexSpec) {
+	engine.RegisterIndex(t, specs...)
+}
+
+// NewInsertIndexer represents an insert indexer
+func NewInsertIndexer(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewInsertIndexer(key, input)
+}
+
+// NewUpdateIndexer represents an update indexer
+func NewUpdateIndexer(key *datastore.Key, input interface{}, options ...UpdateOption) Indexer {
+	return engine.NewUpdateIndexer(key, input, options...)
+}
+
+// NewUpsertIndexer represents an upsert indexer. A missing entity is indexed
+// as a new one.
+func NewUpsertIndexer(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewUpsertIndexer(key, input)
+}
+
+// NewDeleteIndexer represents a delete indexer
+func NewDeleteIndexer(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewDeleteIndexer(key, input)
+}
+
+// NewInsertWriter represents an insert indexer that also inserts the entity
+func NewInsertWriter(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewInsertWriter(key, input)
+}
+
+// NewUpdateWriter represents an update indexer that also updates the entity
+func NewUpdateWriter(key *datastore.Key, input interface{}, options ...UpdateOption) Indexer {
+	return engine.NewUpdateWriter(key, input, options...)
+}
+
+// NewUpsertWriter represents an upsert indexer that also upserts the entity
+func NewUpsertWriter(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewUpsertWriter(key, input)
+}
+
+// NewDeleteWriter represents a delete indexer that also deletes the entity
+func NewDeleteWriter(key *datastore.Key, input interface{}) Indexer {
+	return engine.NewDeleteWriter(key, input)
+}
+
+// NewBatchInsertIndexer represents an insert indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func NewBatchInsertIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	return engine.NewBatchInsertIndexer(keys, entities)
+}
+
+// NewBatchUpdateIndexer represents an update indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func NewBatchUpdateIndexer(keys []*datastore.Key, entities interface{}, options ...UpdateOption) Indexer {
+	return engine.NewBatchUpdateIndexer(keys, entities, options...)
+}
+
+// NewBatchUpsertIndexer represents an upsert indexer for multiple entities.
+// The entities must be a slice with the same length as the keys.
+func NewBatchUpsertIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	return engine.NewBatchUpsertIndexer(keys, entities)
+}
+
+// NewBatchDeleteIndexer represents a delete indexer for multiple entities.
+// The entities must be a slice with the same length as the keys. They are
+// used to load the stored state of the entities.
+func NewBatchDeleteIndexer(keys []*datastore.Key, entities interface{}) Indexer {
+	return engine.NewBatchDeleteIndexer(keys, entities)
+}
+
+// LookupByIndex returns the key of the entity that owns the given values of
+// a unique index. See Engine.LookupByIndex.
+func LookupByIndex(ctx context.Context, client *datastore.Client, kind, name string, values ...interface{}) (*datastore.Key, error) {
+	return engine.LookupByIndex(ctx, client, kind, name, values...)
+}
+
+// LookupByIndexOf returns the key of the entity that owns the given values of
+// the unique index defined by the prototype type. See Engine.LookupByIndexOf.
+func LookupByIndexOf(ctx context.Context, client *datastore.Client, kind string, prototype interface{}, name string, values ...interface{}) (*datastore.Key, error) {
+	return engine.LookupByIndexOf(ctx, client, kind, prototype, name, values...)
+}
+
+// LookupByIndexIn returns the key of the entity under the parent that owns the
+// given values of a scoped unique index. See Engine.LookupByIndexIn.
+func LookupByIndexIn(ctx context.Context, client *datastore.Client, parent *datastore.Key, kind string, prototype interface{}, name string, values ...interface{}) (*datastore.Key, error) {
+	return engine.LookupByIndexIn(ctx, client, parent, kind, prototype, name, values...)
+}
+
+// GetByIndex loads the entity that owns the given values of a unique index
+// into dst. See Engine.GetByIndex.
+func GetByIndex(ctx context.Context, client *datastore.Client, kind, name string, dst interface{}, values ...interface{}) error {
+	return engine.GetByIndex(ctx, client, kind, name, dst, values...)
+}
+
+// Verify reports the missing, orphaned and conflicting index keys of the kind.
+// See Engine.Verify.
+func Verify(ctx context.Context, client *datastore.Client, kind string, prototype interface{}) (*IndexReport, error) {
+	return engine.Verify(ctx, client, kind, prototype)
+}
+
+// Repair repairs the missing and orphaned index keys of the kind. See
+// Engine.Repair.
+func Repair(ctx context.Context, client *datastore.Client, kind string, prototype interface{}, options ...RepairOption) (*IndexReport, error) {
+	return engine.Repair(ctx, client, kind, prototype, options...)
+}
+
+// DropIndex deletes the entities of the index of the entity kind. See
+// Engine.DropIndex.
+func DropIndex(ctx context.Context, client *datastore.Client, kind, name string) (int, error) {
+	return engine.DropIndex(ctx, client, kind, name)
+}
+
+// DropEncoding deletes the entities of the index of the entity kind whose key
+// names are in the given encoding. See Engine.DropEncoding.
+func DropEncoding(ctx context.Context, client *datastore.Client, kind, name, encoding string) (int, error) {
+	return engine.DropEncoding(ctx, client, kind, name, encoding)
+}
+
+// UnknownIndexes returns the index kinds that none of the given kinds claims.
+// See Engine.UnknownIndexes.
+func UnknownIndexes(ctx context.Context, client *datastore.Client, kinds map[string]interface{}) ([]string, error) {
+	return engine.UnknownIndexes(ctx, client, kinds)
+}
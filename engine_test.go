@@ -0,0 +1,79 @@
+package firestorm_test
+
+import (
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Engine", func() {
+	var engine *firestorm.Engine
+
+	BeforeEach(func() {
+		engine = firestorm.NewEngine()
+	})
+
+	It("owns its mapper", func() {
+		Expect(engine.Mapper).NotTo(BeIdenticalTo(firestorm.DefaultEngine().Mapper))
+
+		engine.RegisterIndex(reflect.TypeOf(Order{}), firestorm.IndexSpec{
+			Name:   "external_ref",
+			Fields: []string{"Vendor", "ExternalID"},
+		})
+
+		Expect(*engine.Mapper.Tree(reflect.TypeOf(Order{}))).To(HaveLen(1))
+		Expect(*firestorm.NewEngine().Mapper.Tree(reflect.TypeOf(Order{}))).To(BeEmpty())
+	})
+
+	Describe("Options", func() {
+		var entity *Entity
+
+		BeforeEach(func() {
+			entity = &Entity{
+				ID:    &datastore.Key{Kind: "entity", Name: "007", Namespace: "tenant"},
+				Email: "john@example.com",
+			}
+
+			engine.Options = firestorm.KeyOptions{
+				Prefix:    "idx_",
+				Namespace: "indexes",
+				Encoding:  firestorm.CanonicalEncoding,
+			}
+		})
+
+		It("constructs the keys with the options", func() {
+			maptree := engine.Mapper.Tree(reflect.TypeOf(entity))
+
+			keys, err := maptree.KeysOf(entity.ID, reflect.ValueOf(entity), &engine.Options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].Key.Kind).To(Equal("idx_entity_email_index"))
+			Expect(keys[0].Key.Namespace).To(Equal("indexes"))
+			Expect(keys[0].Key.Name).To(Equal(`canonical:s"john@example.com"`))
+			Expect(keys[0].Owner).To(Equal(entity.ID))
+		})
+
+		Context("when the index defines an encoding", func() {
+			It("uses the encoding of the index", func() {
+				engine.Options.Encoding = firestorm.SHA256Encoding
+
+				product := &Product{
+					ID:     datastore.NameKey("product", "007", nil),
+					Vendor: "acme",
+					SKU:    42,
+				}
+
+				maptree := engine.Mapper.Tree(reflect.TypeOf(product))
+
+				keys, err := maptree.KeysOf(product.ID, reflect.ValueOf(product), &engine.Options)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Key.Name).To(Equal(`canonical:s"acme",i42`))
+			})
+		})
+	})
+})
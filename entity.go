@@ -0,0 +1,70 @@
+package firestorm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// entityTypeOf returns the type of the entity held by the input, which is a
+// struct or a datastore.PropertyLoadSaver, a pointer to one or a pointer to
+// pointer
+func entityTypeOf(input interface{}) (reflect.Type, error) {
+	if input == nil {
+		return nil, fmt.Errorf("%w: <nil>", ErrInvalidEntity)
+	}
+
+	kind := reflect.TypeOf(input)
+
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	switch {
+	case kind.Kind() == reflect.Struct:
+	case reflect.PtrTo(kind).Implements(loadSaverType):
+	default:
+		return nil, fmt.Errorf("%w: %T is not a struct or a datastore.PropertyLoadSaver", ErrInvalidEntity, input)
+	}
+
+	return kind, nil
+}
+
+// entityOf returns the type and the value of the entity held by the input. It
+// fails for the nil pointers.
+func entityOf(input interface{}) (reflect.Type, reflect.Value, error) {
+	kind, err := entityTypeOf(input)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+
+	value := reflect.ValueOf(input)
+
+	for current := value; current.Kind() == reflect.Ptr; current = current.Elem() {
+		if current.IsNil() {
+			return nil, reflect.Value{}, fmt.Errorf("%w: nil %T", ErrInvalidEntity, input)
+		}
+	}
+
+	return kind, value, nil
+}
+
+// pointerOf returns the pointer to the entity held by the input, which the
+// datastore package saves
+func pointerOf(input interface{}) interface{} {
+	value := reflect.ValueOf(input)
+
+	switch {
+	case !value.IsValid():
+		return input
+	case value.Kind() != reflect.Ptr:
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		return ptr.Interface()
+	}
+
+	for value.Elem().Kind() == reflect.Ptr && !value.Elem().IsNil() {
+		value = value.Elem()
+	}
+
+	return value.Interface()
+}
@@ -0,0 +1,48 @@
+package firestorm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ErrInvalidEntity is returned when an entity is not a struct or a
+// datastore.PropertyLoadSaver, a pointer to one or a pointer to pointer
+var ErrInvalidEntity = errors.New("firestorm: invalid entity")
+
+// IndexConflictError is returned when a unique index value is already owned
+// by another entity
+type IndexConflictError struct {
+	// Kind is the kind of the indexed entity
+	Kind string
+	// Index is the name of the index
+	Index string
+	// Fields are the property names of the conflicting fields
+	Fields []string
+	// Values are the conflicting values
+	Values []interface{}
+	// Owner is the key of the entity that owns the values (if known)
+	Owner *datastore.Key
+}
+
+// Error returns the error message
+func (e *IndexConflictError) Error() string {
+	pairs := []string{}
+
+	for index, field := range e.Fields {
+		if index < len(e.Values) {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", field, e.Values[index]))
+		}
+	}
+
+	message := fmt.Sprintf("firestorm: %s index %q conflict on %s",
+		e.Kind, e.Index, strings.Join(pairs, ", "))
+
+	if e.Owner != nil {
+		message = fmt.Sprintf("%s owned by %v", message, e.Owner)
+	}
+
+	return message
+}
@@ -0,0 +1,49 @@
+package firestorm_test
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IndexConflictError", func() {
+	var conflict *firestorm.IndexConflictError
+
+	BeforeEach(func() {
+		conflict = &firestorm.IndexConflictError{
+			Kind:   "entity",
+			Index:  "email",
+			Fields: []string{"email"},
+			Values: []interface{}{"john@example.com"},
+		}
+	})
+
+	It("returns the error message", func() {
+		Expect(conflict).To(MatchError(`firestorm: entity index "email" conflict on email=john@example.com`))
+	})
+
+	Context("when the owner is known", func() {
+		BeforeEach(func() {
+			conflict.Owner = datastore.NameKey("entity", "007", nil)
+		})
+
+		It("returns the error message", func() {
+			Expect(conflict).To(MatchError(`firestorm: entity index "email" conflict on email=john@example.com owned by /entity,007`))
+		})
+	})
+
+	Context("when the error is wrapped", func() {
+		It("can be unwrapped", func() {
+			err := fmt.Errorf("oh no: %w", conflict)
+
+			target := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &target)).To(BeTrue())
+			Expect(target).To(Equal(conflict))
+		})
+	})
+})
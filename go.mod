@@ -9,5 +9,5 @@ require (
 	github.com/mitchellh/hashstructure v1.0.0
 	github.com/onsi/ginkgo v1.12.0
 	github.com/onsi/gomega v1.9.0
-	google.golang.org/api v0.20.0 // indirect
+	google.golang.org/api v0.20.0
 )
@@ -2,179 +2,257 @@ package firestorm
 
 import (
 	"reflect"
-	"sync"
 
 	"cloud.google.com/go/datastore"
 )
 
-var mapper = &IndexMapper{
-	Mutex: &sync.Mutex{},
-	Cache: make(map[reflect.Type]*IndexTree),
+// Reader represents the reads of a datastore transaction
+type Reader interface {
+	// Get loads the entity stored for the key into dst
+	Get(key *datastore.Key, dst interface{}) error
+	// GetMulti is a batch version of Get
+	GetMulti(keys []*datastore.Key, dst interface{}) error
+}
+
+// Transaction represents the operations of a transaction that the indexers
+// use. It is implemented by *MemoryTransaction and by the transactions that
+// NewTransaction returns for the datastore transactions.
+type Transaction interface {
+	Reader
+	// Apply applies the changeset when the transaction is committed
+	Apply(changes *Changeset) error
+}
+
+// NewTransaction returns the Transaction of the datastore transaction
+func NewTransaction(tx *datastore.Transaction) Transaction {
+	return &transaction{Transaction: tx}
+}
+
+// transaction applies the changesets to a datastore transaction
+type transaction struct {
+	*datastore.Transaction
+}
+
+// Apply applies the mutations of the changeset with a single Mutate call
+func (tx *transaction) Apply(changes *Changeset) error {
+	if changes.Len() == 0 {
+		return nil
+	}
+
+	_, err := tx.Mutate(changes.Mutations()...)
+	return err
 }
 
 // Indexer represents an entity indexer
 type Indexer interface {
-	Index(tx *datastore.Transaction) error
+	Index(tx Transaction) error
 }
 
 // IndexerFunc represents a checker func
-type IndexerFunc func(tx *datastore.Transaction) error
+type IndexerFunc func(tx Transaction) error
 
 // Index indexes the record
-func (fn IndexerFunc) Index(tx *datastore.Transaction) error {
+func (fn IndexerFunc) Index(tx Transaction) error {
 	return fn(tx)
 }
 
 // NewInsertIndexer represents an insert indexer
-func NewInsertIndexer(key *datastore.Key, input interface{}) Indexer {
-	var (
-		tree   = mapper.Tree(reflect.TypeOf(input))
-		entity = reflect.ValueOf(input)
-	)
-
-	fn := func(tx *datastore.Transaction) error {
-		treeNext, err := tree.Keys(key, entity)
-		if err != nil || len(treeNext) == 0 {
-			return err
-		}
-
-		ops := []*datastore.Mutation{}
-
-		for _, next := range treeNext {
-			ops = append(ops, datastore.NewInsert(next.Key, next))
-		}
+func (e *Engine) NewInsertIndexer(key *datastore.Key, input interface{}) Indexer {
+	return writer(nil, e.insert(key, input))
+}
 
-		_, err = tx.Mutate(ops...)
-		return err
+// NewInsertWriter represents an insert indexer that also inserts the entity.
+// The entity and its indexes are inserted with a single Mutate call, so an
+// existing entity fails the whole write.
+func (e *Engine) NewInsertWriter(key *datastore.Key, input interface{}) Indexer {
+	entity := func() *EntityMutation {
+		return &EntityMutation{Operation: InsertOperation, Key: key, Entity: pointerOf(input)}
 	}
 
-	return IndexerFunc(fn)
+	return writer(entity, e.insert(key, input))
 }
 
-// NewUpdateIndexer represents an update indexer
-func NewUpdateIndexer(key *datastore.Key, input interface{}) Indexer {
-	var (
-		kind   = reflect.TypeOf(input)
-		tree   = mapper.Tree(kind)
-		empty  = reflect.New(kind.Elem())
-		entity = reflect.ValueOf(input)
-	)
-
-	fn := func(tx *datastore.Transaction) error {
-		treeNext, err := tree.Keys(key, entity)
-		if err != nil || len(treeNext) == 0 {
-			return err
+func (e *Engine) insert(key *datastore.Key, input interface{}) mutator {
+	return func(reader Reader) (IndexChangeset, error) {
+		kind, entity, err := entityOf(input)
+		if err != nil {
+			return nil, err
 		}
 
-		if err = tx.Get(key, empty.Interface()); err != nil {
-			return err
-		}
+		tree := e.Mapper.Tree(kind)
 
-		treePrev, err := tree.Keys(key, empty)
+		treeNext, err := tree.KeysOf(key, entity, &e.Options)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		ops := []*datastore.Mutation{}
+		return tree.Diff(nil, treeNext), nil
+	}
+}
 
-		for index, next := range treeNext {
-			prev := treePrev[index]
+// UpdateOption configures an update indexer
+type UpdateOption func(*UpdateOptions)
 
-			if prev.Hash == next.Hash {
-				continue
-			}
+// UpdateOptions represents the update indexer options
+type UpdateOptions struct {
+	// AllowMissing treats a missing stored entity as an entity without
+	// previous state, so its indexes are only inserted
+	AllowMissing bool
+}
 
-			ops = append(ops, datastore.NewDelete(prev.Key))
-			ops = append(ops, datastore.NewInsert(next.Key, next))
-		}
+// AllowMissing allows the update of entities that are not stored yet
+func AllowMissing() UpdateOption {
+	return func(opts *UpdateOptions) {
+		opts.AllowMissing = true
+	}
+}
+
+func updateOptionsOf(options []UpdateOption) *UpdateOptions {
+	opts := &UpdateOptions{}
 
-		_, err = tx.Mutate(ops...)
-		return err
+	for _, option := range options {
+		option(opts)
 	}
 
-	return IndexerFunc(fn)
+	return opts
+}
+
+// NewUpdateIndexer represents an update indexer
+func (e *Engine) NewUpdateIndexer(key *datastore.Key, input interface{}, options ...UpdateOption) Indexer {
+	return writer(nil, e.update(key, input, updateOptionsOf(options)))
 }
 
-// NewUpsertIndexer represents an update indexer
-func NewUpsertIndexer(key *datastore.Key, input interface{}) Indexer {
-	var (
-		kind   = reflect.TypeOf(input)
-		tree   = mapper.Tree(kind)
-		empty  = reflect.New(kind.Elem())
-		entity = reflect.ValueOf(input)
-	)
+// NewUpdateWriter represents an update indexer that also updates the entity.
+// The entity is upserted if the options allow a missing entity.
+func (e *Engine) NewUpdateWriter(key *datastore.Key, input interface{}, options ...UpdateOption) Indexer {
+	opts := updateOptionsOf(options)
 
-	fn := func(tx *datastore.Transaction) error {
-		treeNext, err := tree.Keys(key, entity)
-		if err != nil || len(treeNext) == 0 {
-			return err
+	entity := func() *EntityMutation {
+		if opts.AllowMissing {
+			return &EntityMutation{Operation: UpsertOperation, Key: key, Entity: pointerOf(input)}
 		}
 
-		err = tx.Get(key, empty.Interface())
+		return &EntityMutation{Operation: UpdateOperation, Key: key, Entity: pointerOf(input)}
+	}
 
-		switch {
-		case err == datastore.ErrNoSuchEntity:
-		case err != nil:
-			return err
-		}
+	return writer(entity, e.update(key, input, opts))
+}
 
-		treePrev, err := tree.Keys(key, empty)
+func (e *Engine) update(key *datastore.Key, input interface{}, opts *UpdateOptions) mutator {
+	return func(reader Reader) (IndexChangeset, error) {
+		kind, entity, err := entityOf(input)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		ops := []*datastore.Mutation{}
+		tree := e.Mapper.Tree(kind)
+
+		treeNext, err := tree.KeysOf(key, entity, &e.Options)
+		if err != nil || len(*tree) == 0 {
+			return IndexChangeset{}, err
+		}
 
-		for index, next := range treeNext {
-			prev := treePrev[index]
+		var (
+			empty    = reflect.New(kind)
+			treePrev = []*IndexKey{}
+		)
 
-			if prev.Hash == next.Hash {
-				continue
-			}
+		err = reader.Get(key, empty.Interface())
 
-			ops = append(ops, datastore.NewDelete(prev.Key))
-			ops = append(ops, datastore.NewInsert(next.Key, next))
+		switch {
+		case err == datastore.ErrNoSuchEntity && opts.AllowMissing:
+			// the entity has no previous state
+		case err != nil:
+			return nil, err
+		default:
+			if treePrev, err = tree.KeysOf(key, empty, &e.Options); err != nil {
+				return nil, err
+			}
 		}
 
-		_, err = tx.Mutate(ops...)
-		return err
+		return tree.Diff(treePrev, treeNext), nil
 	}
+}
+
+// NewUpsertIndexer represents an upsert indexer. A missing entity is indexed
+// as a new one.
+func (e *Engine) NewUpsertIndexer(key *datastore.Key, input interface{}) Indexer {
+	return e.NewUpdateIndexer(key, input, AllowMissing())
+}
 
-	return IndexerFunc(fn)
+// NewUpsertWriter represents an upsert indexer that also upserts the entity
+func (e *Engine) NewUpsertWriter(key *datastore.Key, input interface{}) Indexer {
+	return e.NewUpdateWriter(key, input, AllowMissing())
 }
 
 // NewDeleteIndexer represents an upsert check
-func NewDeleteIndexer(key *datastore.Key, input interface{}) Indexer {
-	var (
-		kind   = reflect.TypeOf(input)
-		tree   = mapper.Tree(kind)
-		entity = reflect.ValueOf(input)
-	)
+func (e *Engine) NewDeleteIndexer(key *datastore.Key, input interface{}) Indexer {
+	return writer(nil, e.delete(key, input))
+}
+
+// NewDeleteWriter represents a delete indexer that also deletes the entity.
+// The input is used to load the stored state of the entity.
+func (e *Engine) NewDeleteWriter(key *datastore.Key, input interface{}) Indexer {
+	entity := func() *EntityMutation {
+		return &EntityMutation{Operation: DeleteOperation, Key: key}
+	}
 
-	fn := func(tx *datastore.Transaction) error {
-		err := tx.Get(key, input)
+	return writer(entity, e.delete(key, input))
+}
+
+func (e *Engine) delete(key *datastore.Key, input interface{}) mutator {
+	return func(reader Reader) (IndexChangeset, error) {
+		kind, err := entityTypeOf(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			tree   = e.Mapper.Tree(kind)
+			entity = reflect.ValueOf(input)
+		)
+
+		// the stored state is loaded into the input only if it is a pointer
+		// to the entity
+		if entity.Type() != reflect.PtrTo(kind) || entity.IsNil() {
+			entity = reflect.New(kind)
+		}
+
+		err = reader.Get(key, entity.Interface())
 
 		switch {
 		case err == datastore.ErrNoSuchEntity:
-			return nil
+			return IndexChangeset{}, nil
 		case err != nil:
-			return err
+			return nil, err
 		}
 
-		treePrev, err := tree.Keys(key, entity)
-		if err != nil || len(treePrev) == 0 {
-			return err
+		treePrev, err := tree.KeysOf(key, entity, &e.Options)
+		if err != nil {
+			return nil, err
 		}
 
-		ops := []*datastore.Mutation{}
-
-		for _, prev := range treePrev {
-			ops = append(ops, datastore.NewDelete(prev.Key))
-		}
+		return tree.Diff(treePrev, nil), nil
+	}
+}
 
-		_, err = tx.Mutate(ops...)
-		return err
+// mutations returns the mutations that apply the given index changes.
+// It returns *IndexConflictError if a unique value is owned by another entity.
+func mutations(reader Reader, changeset IndexChangeset) ([]*datastore.Mutation, error) {
+	changes, err := plan(reader, changeset, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return IndexerFunc(fn)
+	return changes.Mutations(), nil
+}
+
+func conflict(key *IndexKey, owner *datastore.Key) *IndexConflictError {
+	return &IndexConflictError{
+		Kind:   key.Owner.Kind,
+		Index:  key.Index,
+		Fields: key.index.Properties,
+		Values: key.Values,
+		Owner:  owner,
+	}
 }
@@ -2,6 +2,7 @@ package firestorm_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"cloud.google.com/go/datastore"
@@ -15,9 +16,9 @@ var _ = Describe("IndexFunc", func() {
 	It("executes the function", func() {
 		var (
 			count = 0
-			tx    = &datastore.Transaction{}
+			tx    = firestorm.NewMemory().NewTransaction()
 		)
-		fn := func(current *datastore.Transaction) error {
+		fn := func(current firestorm.Transaction) error {
 			Expect(current).To(Equal(tx))
 			count++
 			return fmt.Errorf("oh no")
@@ -63,7 +64,7 @@ var _ = Describe("NewInsertIndexer", func() {
 	It("inserts the new index successfully", func() {
 		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 			indexer := firestorm.NewInsertIndexer(entity.ID, entity)
-			return indexer.Index(tx)
+			return indexer.Index(firestorm.NewTransaction(tx))
 		})
 
 		Expect(err).NotTo(HaveOccurred())
@@ -73,7 +74,7 @@ var _ = Describe("NewInsertIndexer", func() {
 		BeforeEach(func() {
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewInsertIndexer(entity.ID, entity)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
 			Expect(err).NotTo(HaveOccurred())
@@ -87,10 +88,48 @@ var _ = Describe("NewInsertIndexer", func() {
 
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewInsertIndexer(entity.ID, entity)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
-			Expect(err).To(MatchError("rpc error: code = AlreadyExists desc = entity already exists"))
+			conflict := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Kind).To(Equal("entity"))
+			Expect(conflict.Index).To(Equal("email"))
+			Expect(conflict.Fields).To(Equal([]string{"email"}))
+			Expect(conflict.Values).To(Equal([]interface{}{"john@example.com"}))
+			Expect(conflict.Owner).To(Equal(datastore.NameKey("entity", "007", nil)))
+		})
+	})
+
+	Context("when the index is not unique", func() {
+		AfterEach(func() {
+			query := datastore.NewQuery("employee_company_index").KeysOnly()
+
+			keys, err := client.GetAll(ctx, query, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+		})
+
+		It("inserts an index for every entity", func() {
+			employees := []*Employee{
+				{ID: datastore.NameKey("employee", "007", nil), Name: "John", Company: "Phogo Labs"},
+				{ID: datastore.NameKey("employee", "008", nil), Name: "Mike", Company: "Phogo Labs"},
+			}
+
+			for _, employee := range employees {
+				_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+					indexer := firestorm.NewInsertIndexer(employee.ID, employee)
+					return indexer.Index(firestorm.NewTransaction(tx))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			query := datastore.NewQuery("employee_company_index").KeysOnly()
+
+			keys, err := client.GetAll(ctx, query, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(2))
 		})
 	})
 })
@@ -123,7 +162,7 @@ var _ = Describe("NewUpdateIndexer", func() {
 			}
 
 			indexer := firestorm.NewInsertIndexer(entity.ID, entity)
-			return indexer.Index(tx)
+			return indexer.Index(firestorm.NewTransaction(tx))
 		})
 
 		Expect(err).NotTo(HaveOccurred())
@@ -149,7 +188,7 @@ var _ = Describe("NewUpdateIndexer", func() {
 
 		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 			indexer := firestorm.NewUpdateIndexer(entity.ID, entity)
-			return indexer.Index(tx)
+			return indexer.Index(firestorm.NewTransaction(tx))
 		})
 
 		Expect(err).NotTo(HaveOccurred())
@@ -159,7 +198,7 @@ var _ = Describe("NewUpdateIndexer", func() {
 		It("updates the index successfully", func() {
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewUpdateIndexer(entity.ID, entity)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
 			Expect(err).NotTo(HaveOccurred())
@@ -181,7 +220,7 @@ var _ = Describe("NewUpdateIndexer", func() {
 		It("returns an error", func() {
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewUpdateIndexer(next.ID, next)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
 			Expect(err).To(MatchError("datastore: no such entity"))
@@ -212,48 +251,211 @@ var _ = Describe("NewUpdateIndexer", func() {
 
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewUpdateIndexer(next.ID, next)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			conflict := &firestorm.IndexConflictError{}
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Kind).To(Equal("entity"))
+			Expect(conflict.Index).To(Equal("email"))
+			Expect(conflict.Fields).To(Equal([]string{"email"}))
+			Expect(conflict.Values).To(Equal([]interface{}{"john@example.com"}))
+			Expect(conflict.Owner).To(Equal(datastore.NameKey("entity", "007", nil)))
+		})
+	})
+})
+
+var _ = Describe("NewUpdateIndexer", func() {
+	Context("when the index is sparse", func() {
+		var (
+			ctx    context.Context
+			user   *User
+			client *datastore.Client
+		)
+
+		lookup := func(phone string) (*datastore.Key, error) {
+			return firestorm.LookupByIndex(ctx, client, "user", "phone", firestorm.String(phone))
+		}
+
+		update := func() error {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewUpdateIndexer(user.ID, user)
+
+				if err := indexer.Index(firestorm.NewTransaction(tx)); err != nil {
+					return err
+				}
+
+				_, err := tx.Put(user.ID, user)
+				return err
 			})
 
-			Expect(err).To(MatchError("rpc error: code = AlreadyExists desc = entity already exists"))
+			return err
+		}
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+
+			user = &User{
+				ID:    datastore.NameKey("user", "007", nil),
+				Email: "john@example.com",
+			}
+
+			var err error
+
+			client, err = datastore.NewClient(ctx, "foo-bar")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				if _, err := tx.Put(user.ID, user); err != nil {
+					return err
+				}
+
+				indexer := firestorm.NewInsertIndexer(user.ID, user)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			for _, kind := range []string{"user", "user_email_index", "user_phone_index"} {
+				query := datastore.NewQuery(kind).KeysOnly()
+
+				keys, err := client.GetAll(ctx, query, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+			}
+
+			Expect(client.Close()).To(Succeed())
+		})
+
+		It("creates and removes the index", func() {
+			user.Phone = firestorm.String("+359888123456")
+			Expect(update()).To(Succeed())
+
+			owner, err := lookup("+359888123456")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(user.ID))
+
+			user.Phone = nil
+			Expect(update()).To(Succeed())
+
+			_, err = lookup("+359888123456")
+			Expect(err).To(MatchError("datastore: no such entity"))
+		})
+
+		Context("when another entity has an empty value", func() {
+			It("inserts the entity successfully", func() {
+				other := &User{
+					ID:    datastore.NameKey("user", "008", nil),
+					Email: "jack@example.com",
+				}
+
+				_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+					indexer := firestorm.NewInsertIndexer(other.ID, other)
+					return indexer.Index(firestorm.NewTransaction(tx))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+			})
 		})
 	})
 })
 
-// var _ = Describe("NewUpsertndexer", func() {
-// 	var (
-// 		ctx    context.Context
-// 		entity *Entity
-// 		client *datastore.Client
-// 	)
+var _ = Describe("NewUpsertIndexer", func() {
+	var (
+		ctx    context.Context
+		entity *Entity
+		client *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entity = &Entity{
+			ID:        datastore.NameKey("entity", "007", nil),
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john@example.com",
+		}
+
+		var err error
+
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, kind := range []string{"entity", "entity_email_index"} {
+			query := datastore.NewQuery(kind).KeysOnly()
+
+			keys, err := client.GetAll(ctx, query, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+		}
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("inserts the index of a new entity", func() {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			indexer := firestorm.NewUpsertIndexer(entity.ID, entity)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", entity.Email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(entity.ID))
+	})
+
+	Context("when another entity owns the empty value", func() {
+		var empty *Entity
+
+		BeforeEach(func() {
+			empty = &Entity{
+				ID:        datastore.NameKey("entity", "008", nil),
+				FirstName: "Jack",
+			}
+
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				if _, err := tx.Put(empty.ID, empty); err != nil {
+					return err
+				}
 
-// 	BeforeEach(func() {
-// 		ctx = context.TODO()
+				indexer := firestorm.NewUpsertIndexer(empty.ID, empty)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
 
-// 		entity = &Entity{
-// 			ID:        datastore.NameKey("entity", "007", nil),
-// 			FirstName: "John",
-// 			LastName:  "Doe",
-// 			Email:     "john@example.com",
-// 		}
+			Expect(err).NotTo(HaveOccurred())
+		})
 
-// 		var err error
+		It("does not delete the index of the other entity", func() {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewUpsertIndexer(entity.ID, entity)
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
 
-// 		client, err = datastore.NewClient(ctx, "foo-bar")
-// 		Expect(err).NotTo(HaveOccurred())
-// 	})
+			Expect(err).NotTo(HaveOccurred())
 
-// 	AfterEach(func() {
-// 		Expect(client.Delete(ctx, &datastore.Key{
-// 			Name: "14491862341308332741",
-// 			Kind: "entity_email_index",
-// 		})).To(Succeed())
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(empty.ID))
+		})
+	})
 
-// 		Expect(client.Delete(ctx, entity.ID)).To(Succeed())
-// 		Expect(client.Close()).To(Succeed())
-// 	})
+	Context("when the update allows missing entities", func() {
+		It("inserts the index of a new entity", func() {
+			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+				indexer := firestorm.NewUpdateIndexer(entity.ID, entity, firestorm.AllowMissing())
+				return indexer.Index(firestorm.NewTransaction(tx))
+			})
 
-// })
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
 
 var _ = Describe("NewDeleteIndexer", func() {
 	var (
@@ -283,7 +485,7 @@ var _ = Describe("NewDeleteIndexer", func() {
 			}
 
 			indexer := firestorm.NewInsertIndexer(entity.ID, entity)
-			return indexer.Index(tx)
+			return indexer.Index(firestorm.NewTransaction(tx))
 		})
 
 		Expect(err).NotTo(HaveOccurred())
@@ -302,7 +504,7 @@ var _ = Describe("NewDeleteIndexer", func() {
 	It("deletes the index successfully", func() {
 		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 			indexer := firestorm.NewDeleteIndexer(entity.ID, entity)
-			return indexer.Index(tx)
+			return indexer.Index(firestorm.NewTransaction(tx))
 		})
 
 		Expect(err).ToNot(HaveOccurred())
@@ -323,7 +525,7 @@ var _ = Describe("NewDeleteIndexer", func() {
 
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewDeleteIndexer(entity.ID, entity)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
 			Expect(err).ToNot(HaveOccurred())
@@ -334,7 +536,7 @@ var _ = Describe("NewDeleteIndexer", func() {
 		It("returns an error", func() {
 			_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 				indexer := firestorm.NewDeleteIndexer(nil, entity)
-				return indexer.Index(tx)
+				return indexer.Index(firestorm.NewTransaction(tx))
 			})
 
 			Expect(err).To(MatchError("datastore: invalid key"))
@@ -0,0 +1,88 @@
+package firestorm
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ErrIndexOwnerUnknown is returned when an index entity does not record its
+// owner. That is the case for indexes created by older versions.
+var ErrIndexOwnerUnknown = errors.New("firestorm: index owner unknown")
+
+// LookupByIndex returns the key of the entity that owns the given values of
+// a unique index. The values must be in the same order and have the same
+// types as the fields that define the index. Values of normalized indexes must
+// be normalized with Normalize first. The index key names are expected to be
+// in the default encoding of the engine. Use LookupByIndexOf for indexes with
+// other encodings.
+func (e *Engine) LookupByIndex(ctx context.Context, client *datastore.Client, kind, name string, values ...interface{}) (*datastore.Key, error) {
+	return e.lookup(ctx, client, &datastore.Key{Kind: kind}, &Index{Name: name, Unique: true}, values)
+}
+
+// LookupByIndexOf returns the key of the entity that owns the given values of
+// the unique index defined by the prototype type. The values are normalized
+// and encoded as the index defines.
+func (e *Engine) LookupByIndexOf(ctx context.Context, client *datastore.Client, kind string, prototype interface{}, name string, values ...interface{}) (*datastore.Key, error) {
+	return e.lookup(ctx, client, &datastore.Key{Kind: kind}, e.indexOf(prototype, name), values)
+}
+
+// LookupByIndexIn returns the key of the entity that owns the given values of
+// the scoped unique index defined by the prototype type. The parent is the
+// parent of the looked up entity, which the scope of the index is resolved
+// from.
+func (e *Engine) LookupByIndexIn(ctx context.Context, client *datastore.Client, parent *datastore.Key, kind string, prototype interface{}, name string, values ...interface{}) (*datastore.Key, error) {
+	owner := &datastore.Key{Kind: kind, Parent: parent}
+
+	if parent != nil {
+		owner.Namespace = parent.Namespace
+	}
+
+	return e.lookup(ctx, client, owner, e.indexOf(prototype, name), values)
+}
+
+// GetByIndex loads the entity that owns the given values of a unique index
+// into dst. The index definition is resolved from the type of dst.
+func (e *Engine) GetByIndex(ctx context.Context, client *datastore.Client, kind, name string, dst interface{}, values ...interface{}) error {
+	key, err := e.LookupByIndexOf(ctx, client, kind, dst, name, values...)
+	if err != nil {
+		return err
+	}
+
+	return client.Get(ctx, key, dst)
+}
+
+func (e *Engine) indexOf(prototype interface{}, name string) *Index {
+	if kind, err := entityTypeOf(prototype); err == nil {
+		if index := e.Mapper.Tree(kind).Index(name); index != nil {
+			return index
+		}
+	}
+
+	return &Index{Name: name, Unique: true}
+}
+
+func (e *Engine) lookup(ctx context.Context, client *datastore.Client, owner *datastore.Key, index *Index, values []interface{}) (*datastore.Key, error) {
+	values, err := index.Normalize(values)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := e.Options.Key(owner, index, values)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := &IndexKey{}
+
+	if err := client.Get(ctx, key.Key, entity); err != nil {
+		return nil, err
+	}
+
+	if entity.Owner == nil {
+		return nil, ErrIndexOwnerUnknown
+	}
+
+	return entity.Owner, nil
+}
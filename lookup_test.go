@@ -0,0 +1,123 @@
+package firestorm_test
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LookupByIndex", func() {
+	var (
+		ctx    context.Context
+		entity *Entity
+		client *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entity = &Entity{
+			ID:        datastore.NameKey("entity", "007", nil),
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john@example.com",
+		}
+
+		var err error
+
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if _, err := tx.Put(entity.ID, entity); err != nil {
+				return err
+			}
+
+			indexer := firestorm.NewInsertIndexer(entity.ID, entity)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Delete(ctx, &datastore.Key{
+			Name: "14491862341308332741",
+			Kind: "entity_email_index",
+		})).To(Succeed())
+
+		Expect(client.Delete(ctx, entity.ID)).To(Succeed())
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("returns the owner key", func() {
+		key, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "john@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(entity.ID))
+	})
+
+	Context("when the value is not indexed", func() {
+		It("returns an error", func() {
+			key, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "jack@example.com")
+			Expect(err).To(MatchError("datastore: no such entity"))
+			Expect(key).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("GetByIndex", func() {
+	var (
+		ctx    context.Context
+		entity *Entity
+		client *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entity = &Entity{
+			ID:        datastore.NameKey("entity", "007", nil),
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john@example.com",
+		}
+
+		var err error
+
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if _, err := tx.Put(entity.ID, entity); err != nil {
+				return err
+			}
+
+			indexer := firestorm.NewInsertIndexer(entity.ID, entity)
+			return indexer.Index(firestorm.NewTransaction(tx))
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Delete(ctx, &datastore.Key{
+			Name: "14491862341308332741",
+			Kind: "entity_email_index",
+		})).To(Succeed())
+
+		Expect(client.Delete(ctx, entity.ID)).To(Succeed())
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("loads the owner entity", func() {
+		owner := &Entity{}
+
+		err := firestorm.GetByIndex(ctx, client, "entity", "email", owner, "john@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(entity))
+	})
+})
@@ -1,8 +1,11 @@
 package firestorm
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 
 	"cloud.google.com/go/datastore"
@@ -14,16 +17,42 @@ import (
 type IndexMapper struct {
 	Mutex *sync.Mutex
 	Cache map[reflect.Type]*IndexTree
+	// Specs are the indexes registered without struct tags
+	Specs map[reflect.Type][]IndexSpec
+}
+
+// Register registers the index specs of the given type. The registered specs
+// are merged with the indexes defined by the struct tags. A spec overrides the
+// tag index with the same name.
+func (m *IndexMapper) Register(t reflect.Type, specs ...IndexSpec) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if m.Specs == nil {
+		m.Specs = make(map[reflect.Type][]IndexSpec)
+	}
+
+	m.Specs[t] = append(m.Specs[t], specs...)
+	delete(m.Cache, t)
 }
 
 // Tree returns the index tree
 func (m *IndexMapper) Tree(t reflect.Type) *IndexTree {
 	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
 
-	switch t.Kind() {
-	case reflect.Ptr:
+	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
-	case reflect.Struct:
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct:
+	case reflect.PtrTo(t).Implements(loadSaverType):
+	case len(m.Specs[t]) > 0:
 	default:
 		return nil
 	}
@@ -35,23 +64,74 @@ func (m *IndexMapper) Tree(t reflect.Type) *IndexTree {
 		m.Cache[t] = tree
 	}
 
-	m.Mutex.Unlock()
 	return tree
 }
 
 func (m *IndexMapper) build(t reflect.Type) *IndexTree {
 	maptree := make(map[string]*Index)
 
+	if t.Kind() == reflect.Struct {
+		m.walk(maptree, t, "", map[reflect.Type]bool{t: true})
+	}
+
+	for _, spec := range m.Specs[t] {
+		maptree[spec.Name] = spec.Index(t)
+	}
+
+	tree := IndexTree{}
+
+	for _, index := range maptree {
+		tree = append(tree, index)
+	}
+
+	sort.Slice(tree, func(i, j int) bool {
+		return tree[i].Name < tree[j].Name
+	})
+
+	return &tree
+}
+
+// walk collects the indexes of the struct fields. The fields of the embedded
+// and the nested structs are collected following the datastore flatten
+// semantics, so their properties are prefixed with the name of the parent.
+func (m *IndexMapper) walk(maptree map[string]*Index, t reflect.Type, prefix string, visited map[reflect.Type]bool) {
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
+		if field.PkgPath != "" {
+			continue
+		}
+
 		tags, err := structtag.Parse(string(field.Tag))
 		if err != nil {
 			continue
 		}
 
+		name := prefix + property(field, tags)
+
+		if name == prefix+"-" {
+			continue
+		}
+
 		tag, err := tags.Get("index")
 		if err != nil {
+			nested := structOf(field.Type)
+
+			if nested == nil || visited[nested] {
+				continue
+			}
+
+			next := name + "."
+
+			// the anonymous structs without a name are flattened without prefix
+			if field.Anonymous && !named(tags) {
+				next = prefix
+			}
+
+			visited[nested] = true
+			m.walk(maptree, nested, next, visited)
+			delete(visited, nested)
+
 			continue
 		}
 
@@ -63,18 +143,88 @@ func (m *IndexMapper) build(t reflect.Type) *IndexTree {
 			}
 		}
 
-		index.Properties = append(index.Properties, field.Index)
+		if tag.HasOption("unique") {
+			index.Unique = true
+		}
+
+		if tag.HasOption("sparse") || tag.HasOption("omitempty") {
+			index.Sparse = true
+		}
+
+		for _, option := range tag.Options {
+			switch {
+			case strings.HasPrefix(option, "encoding="):
+				index.Encoding = strings.TrimPrefix(option, "encoding=")
+			case strings.HasPrefix(option, "scope="):
+				index.Scope = strings.TrimPrefix(option, "scope=")
+			}
+		}
+
+		index.Properties = append(index.Properties, name)
+		index.Types = append(index.Types, field.Type)
+		index.Normalizers = append(index.Normalizers, normalizersOf(tag))
+		index.Each = append(index.Each, tag.HasOption("each"))
 
 		maptree[index.Name] = index
 	}
+}
 
-	tree := IndexTree{}
+var (
+	loadSaverType = reflect.TypeOf((*datastore.PropertyLoadSaver)(nil)).Elem()
+	entityType    = reflect.TypeOf(datastore.Entity{})
+	geoPointType  = reflect.TypeOf(datastore.GeoPoint{})
+)
 
-	for _, index := range maptree {
-		tree = append(tree, index)
+// structOf returns the struct type of the nested fields or nil if the type
+// is stored as a single property
+func structOf(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
 
-	return &tree
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	switch t {
+	case timeType, entityType, geoPointType, keyType.Elem():
+		return nil
+	default:
+		return t
+	}
+}
+
+func named(tags *structtag.Tags) bool {
+	tag, err := tags.Get("datastore")
+	return err == nil && tag.Name != ""
+}
+
+// options are the index tag options that are not normalizers
+var options = map[string]bool{
+	"unique":    true,
+	"sparse":    true,
+	"omitempty": true,
+	"each":      true,
+}
+
+func normalizersOf(tag *structtag.Tag) []string {
+	names := []string{}
+
+	for _, option := range tag.Options {
+		if !options[option] && !strings.Contains(option, "=") {
+			names = append(names, option)
+		}
+	}
+
+	return names
+}
+
+func property(field reflect.StructField, tags *structtag.Tags) string {
+	if tag, err := tags.Get("datastore"); err == nil && tag.Name != "" {
+		return tag.Name
+	}
+
+	return field.Name
 }
 
 // IndexTree represents the index
@@ -82,56 +232,649 @@ type IndexTree []*Index
 
 // Keys returns the keys
 func (t *IndexTree) Keys(key *datastore.Key, input reflect.Value) ([]*IndexKey, error) {
+	return t.KeysOf(key, input, &KeyOptions{})
+}
+
+// KeysOf returns the keys constructed with the given options
+func (t *IndexTree) KeysOf(key *datastore.Key, input reflect.Value, options *KeyOptions) ([]*IndexKey, error) {
 	if key == nil {
 		return nil, datastore.ErrInvalidKey
 	}
 
+	// the mapper has no tree for the types that cannot be indexed
+	if t == nil {
+		return nil, fmt.Errorf("%w: %v cannot be indexed", ErrInvalidEntity, input.Type())
+	}
+
 	keys := []*IndexKey{}
 
+	if len(*t) == 0 {
+		return keys, nil
+	}
+
+	props, err := properties(input)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, index := range *t {
-		hash, err := index.Hash(input)
+		tuples, err := index.Tuples(props)
 		if err != nil {
 			return nil, err
 		}
 
-		indexKey := &IndexKey{
-			Key: &datastore.Key{
-				Name:      fmt.Sprintf("%v", hash),
-				Kind:      fmt.Sprintf("%s_%s_index", key.Kind, index.Name),
-				Namespace: key.Namespace,
-			},
-			Hash: hash,
-		}
+		names := make(map[string]bool)
 
-		keys = append(keys, indexKey)
+		for _, values := range tuples {
+			if index.Sparse && sparse(values) {
+				continue
+			}
+
+			indexKey, err := options.Key(key, index, values)
+			if err != nil {
+				return nil, err
+			}
+
+			name := indexKey.Key.Encode()
+
+			if names[name] {
+				if !index.Unique {
+					continue
+				}
+
+				// the same value is used by more than one element
+				return nil, &IndexConflictError{
+					Kind:   key.Kind,
+					Index:  index.Name,
+					Fields: index.Properties,
+					Values: values,
+					Owner:  key,
+				}
+			}
+
+			names[name] = true
+			keys = append(keys, indexKey)
+		}
 	}
 
 	return keys, nil
 }
 
+// KeyOptions configures the construction of the index keys
+type KeyOptions struct {
+	// Strategy names the index entities. The default strategy is the
+	// KindKeyStrategy.
+	Strategy KeyStrategy
+	// Prefix is prepended to the kind of the index entities
+	Prefix string
+	// Namespace places the index entities in the namespace instead of the
+	// namespace of the indexed entity. The scoped index entities stay in the
+	// namespace of their ancestor.
+	Namespace string
+	// Encoding is the encoding of the indexes that do not define one
+	Encoding string
+}
+
+// Key returns the index key of the values owned by the given key
+func (o *KeyOptions) Key(owner *datastore.Key, index *Index, values []interface{}) (*IndexKey, error) {
+	hash, err := hash(values)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := index.Encoding
+
+	if encoding == "" {
+		encoding = o.Encoding
+	}
+
+	name, err := Encode(encoding, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		strategy  = o.strategy()
+		namespace = o.namespace(owner.Namespace)
+	)
+
+	ancestor, err := index.ancestor(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	// the scoped index entities belong to the entity group of the ancestor
+	if ancestor != nil {
+		namespace = ancestor.Namespace
+	}
+
+	indexKey := &IndexKey{
+		Key: &datastore.Key{
+			Name:      strategy.Name(owner.Kind, index.Name, name),
+			Kind:      o.Prefix + strategy.Kind(owner.Kind, index.Name),
+			Namespace: namespace,
+			Parent:    ancestor,
+		},
+		Owner:  owner,
+		Index:  index.Name,
+		Hash:   hash,
+		Values: values,
+		index:  index,
+	}
+
+	if !index.Unique {
+		// non-unique indexes keep one entity per (value, owner) pair
+		// under the value key, so many owners can share a value
+		indexKey.Key = &datastore.Key{
+			Name:      owner.Encode(),
+			Kind:      indexKey.Key.Kind,
+			Namespace: namespace,
+			Parent:    indexKey.Key,
+		}
+	}
+
+	return indexKey, nil
+}
+
+// Query returns the keys-only query of the index entities of the given entity
+// kind and index in the namespace of the indexed entities. If the strategy
+// shares the kind between the indexes, the query does not return the scoped
+// index entities, since they sort by their ancestors.
+func (o *KeyOptions) Query(kind, index, namespace string) *datastore.Query {
+	var (
+		strategy = o.strategy()
+		prefix   = strategy.Name(kind, index, "")
+		query    = datastore.NewQuery(o.Prefix + strategy.Kind(kind, index))
+	)
+
+	query = query.Namespace(o.namespace(namespace)).KeysOnly()
+
+	if prefix != "" {
+		// the strategy shares the kind between the indexes, so the entities of
+		// the index are the ones whose key names start with the prefix
+		start := &datastore.Key{
+			Kind:      o.Prefix + strategy.Kind(kind, index),
+			Name:      prefix,
+			Namespace: o.namespace(namespace),
+		}
+
+		end := &datastore.Key{
+			Kind:      start.Kind,
+			Name:      prefix + "\uffff",
+			Namespace: start.Namespace,
+		}
+
+		query = query.Filter("__key__ >=", start).Filter("__key__ <", end)
+	}
+
+	return query
+}
+
+// scan calls fn with the keys of the index entities of the entity kind and the
+// index in pages of at most the given size. The strategies that share the kind
+// between the indexes place the scoped index entities under their ancestors,
+// outside the key range of Query, so the whole kind is scanned and the keys
+// are matched by their names instead.
+func (o *KeyOptions) scan(ctx context.Context, client *datastore.Client, kind, index, namespace string, size int, fn func(keys []*datastore.Key) error) error {
+	var (
+		strategy = o.strategy()
+		prefix   = strategy.Name(kind, index, "")
+	)
+
+	if prefix == "" {
+		return pages(ctx, client, o.Query(kind, index, namespace), size, fn)
+	}
+
+	query := datastore.NewQuery(o.Prefix + strategy.Kind(kind, index)).
+		Namespace(o.namespace(namespace)).
+		KeysOnly()
+
+	return pages(ctx, client, query, size, func(page []*datastore.Key) error {
+		keys := []*datastore.Key{}
+
+		for _, key := range page {
+			value := key
+
+			// the non-unique index entities are children of the value
+			if isValueChild(key) {
+				value = key.Parent
+			}
+
+			if strings.HasPrefix(value.Name, prefix) {
+				keys = append(keys, key)
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return fn(keys)
+	})
+}
+
+func (o *KeyOptions) strategy() KeyStrategy {
+	if o.Strategy == nil {
+		return &KindKeyStrategy{}
+	}
+
+	return o.Strategy
+}
+
+func (o *KeyOptions) namespace(namespace string) string {
+	if o.Namespace != "" {
+		return o.Namespace
+	}
+
+	return namespace
+}
+
+// Index returns the index with the given name
+func (t *IndexTree) Index(name string) *Index {
+	for _, index := range *t {
+		if index.Name == name {
+			return index
+		}
+	}
+
+	return nil
+}
+
+// Diff returns the changes between the previous and the next index keys of
+// an entity. The changes are grouped by index name in the order of the tree.
+func (t *IndexTree) Diff(prev, next []*IndexKey) IndexChangeset {
+	var (
+		changeset = IndexChangeset{}
+		changes   = make(map[string]*IndexChange)
+		existing  = make(map[string]*IndexKey)
+	)
+
+	for _, index := range *t {
+		change := &IndexChange{Name: index.Name}
+		changes[index.Name] = change
+		changeset = append(changeset, change)
+	}
+
+	change := func(name string) *IndexChange {
+		if _, ok := changes[name]; !ok {
+			changes[name] = &IndexChange{Name: name}
+			changeset = append(changeset, changes[name])
+		}
+
+		return changes[name]
+	}
+
+	for _, key := range prev {
+		existing[key.Key.Encode()] = key
+	}
+
+	for _, key := range next {
+		name := key.Key.Encode()
+
+		if _, ok := existing[name]; ok {
+			delete(existing, name)
+			change(key.Index).Unchanged = append(change(key.Index).Unchanged, key)
+			continue
+		}
+
+		change(key.Index).Added = append(change(key.Index).Added, key)
+	}
+
+	for _, key := range prev {
+		if _, ok := existing[key.Key.Encode()]; ok {
+			change(key.Index).Removed = append(change(key.Index).Removed, key)
+		}
+	}
+
+	return changeset
+}
+
+// IndexChangeset represents the changes of all indexes of an entity
+type IndexChangeset []*IndexChange
+
+// Added returns the index keys that should be inserted
+func (c IndexChangeset) Added() []*IndexKey {
+	keys := []*IndexKey{}
+
+	for _, change := range c {
+		keys = append(keys, change.Added...)
+	}
+
+	return keys
+}
+
+// Removed returns the index keys that should be deleted
+func (c IndexChangeset) Removed() []*IndexKey {
+	keys := []*IndexKey{}
+
+	for _, change := range c {
+		keys = append(keys, change.Removed...)
+	}
+
+	return keys
+}
+
+// IndexChange represents the changes of a single index
+type IndexChange struct {
+	Name      string
+	Added     []*IndexKey
+	Removed   []*IndexKey
+	Unchanged []*IndexKey
+}
+
+// String returns the change summary
+func (c *IndexChange) String() string {
+	return fmt.Sprintf("%s: %d added, %d removed, %d unchanged",
+		c.Name, len(c.Added), len(c.Removed), len(c.Unchanged))
+}
+
 // Index represents the index
 type Index struct {
 	Name string
-	// should be string
-	Properties [][]int
+	// Unique is true when the index allows a single entity per value
+	Unique bool
+	// Sparse is true when the index skips entities that have an empty value
+	// in any of the indexed fields
+	Sparse bool
+	// Properties are the datastore property names of the indexed fields. The
+	// properties of the nested entities are separated with a dot.
+	Properties []string
+	// Normalizers are the names of the normalizers applied to each field
+	Normalizers [][]string
+	// Each is true for the slice fields whose elements are indexed one by one
+	Each []bool
+	// Types are the Go types of the indexed fields. The saved values are
+	// converted back to them, so the hashes are calculated from the same
+	// values as the fields have.
+	Types []reflect.Type
+	// Encoding is the encoding of the index key names
+	Encoding string
+	// Scope is the ancestor of the indexed entity that the index entities are
+	// placed under. The values are unique within the ancestor.
+	Scope string
+}
+
+const (
+	// ParentScope places the index entities under the parent of the indexed
+	// entity
+	ParentScope = "parent"
+	// RootScope places the index entities under the root ancestor of the
+	// indexed entity
+	RootScope = "root"
+)
+
+// ancestor returns the ancestor of the owner that scopes the index
+func (index *Index) ancestor(owner *datastore.Key) (*datastore.Key, error) {
+	switch index.Scope {
+	case "":
+		return nil, nil
+	case ParentScope:
+		if owner.Parent == nil {
+			return nil, fmt.Errorf("firestorm: index %q is scoped to the parent of %v which has none", index.Name, owner)
+		}
+
+		return owner.Parent, nil
+	case RootScope:
+		if owner.Parent == nil {
+			return nil, fmt.Errorf("firestorm: index %q is scoped to the root of %v which has none", index.Name, owner)
+		}
+
+		root := owner.Parent
+
+		for root.Parent != nil {
+			root = root.Parent
+		}
+
+		return root, nil
+	default:
+		return nil, fmt.Errorf("firestorm: unknown index scope %q", index.Scope)
+	}
 }
 
 // Hash calculates the index value
-func (index *Index) Hash(v reflect.Value) (uint64, error) {
-	var fingerprint []interface{}
+func (index *Index) Hash(props []datastore.Property) (uint64, error) {
+	values, err := index.Values(props)
+	if err != nil {
+		return 0, err
+	}
 
-	v = reflect.Indirect(v)
+	return hash(values)
+}
+
+// Values returns the normalized values of the indexed properties
+func (index *Index) Values(props []datastore.Property) ([]interface{}, error) {
+	var fingerprint []interface{}
 
-	for _, position := range index.Properties {
-		value := v.FieldByIndex(position).Interface()
+	for position, name := range index.Properties {
+		value := restore(propertyValue(props, name), index.typeOf(position))
 		fingerprint = append(fingerprint, value)
 	}
 
-	return hashstructure.Hash(fingerprint, nil)
+	return index.Normalize(fingerprint)
+}
+
+// Tuples returns the normalized values of the indexed fields. The `each`
+// fields are expanded, so there is a set of values per slice element (or per
+// combination of elements if there is more than one such field). An `each`
+// field without elements produces no tuples.
+func (index *Index) Tuples(props []datastore.Property) ([][]interface{}, error) {
+	tuples := [][]interface{}{{}}
+
+	for position, name := range index.Properties {
+		var (
+			kind     = index.typeOf(position)
+			value    = propertyValue(props, name)
+			elements = []interface{}{restore(value, kind)}
+		)
+
+		if position < len(index.Each) && index.Each[position] {
+			switch list := value.(type) {
+			case []interface{}:
+				elements = []interface{}{}
+
+				for _, element := range list {
+					elements = append(elements, restore(element, elemOf(kind)))
+				}
+			case nil:
+				// a field without elements produces no tuples
+				elements = nil
+			}
+		}
+
+		next := [][]interface{}{}
+
+		for _, tuple := range tuples {
+			for _, element := range elements {
+				item := append(append([]interface{}{}, tuple...), element)
+				next = append(next, item)
+			}
+		}
+
+		tuples = next
+	}
+
+	for k, tuple := range tuples {
+		values, err := index.Normalize(tuple)
+		if err != nil {
+			return nil, err
+		}
+
+		tuples[k] = values
+	}
+
+	return tuples, nil
+}
+
+// typeOf returns the Go type of the indexed field at the position or nil if
+// it is unknown
+func (index *Index) typeOf(position int) reflect.Type {
+	if position < len(index.Types) {
+		return index.Types[position]
+	}
+
+	return nil
+}
+
+// Normalize applies the normalizers of the indexed fields to the values
+func (index *Index) Normalize(values []interface{}) ([]interface{}, error) {
+	result := make([]interface{}, len(values))
+
+	for position, value := range values {
+		if position < len(index.Normalizers) {
+			var err error
+
+			if value, err = Normalize(value, index.Normalizers[position]...); err != nil {
+				return nil, err
+			}
+		}
+
+		result[position] = value
+	}
+
+	return result, nil
 }
 
 // IndexKey represents an index key
 type IndexKey struct {
-	Key  *datastore.Key `datastore:"__key__"`
-	Hash uint64         `datastore:"-"`
+	Key   *datastore.Key `datastore:"__key__"`
+	Owner *datastore.Key `datastore:"owner"`
+	Index string         `datastore:"index"`
+	Hash  uint64         `datastore:"-"`
+	// Values are the indexed values the hash is calculated from
+	Values []interface{} `datastore:"-"`
+
+	index *Index
+}
+
+// propertyValue returns the value of the named property. The properties of
+// the nested entities are resolved by their dotted names. The values of the
+// properties that have the same name are collected in a slice.
+func propertyValue(props []datastore.Property, name string) interface{} {
+	values := []interface{}{}
+
+	for _, property := range props {
+		if property.Name == name {
+			values = append(values, property.Value)
+		}
+	}
+
+	switch len(values) {
+	case 0:
+	case 1:
+		return values[0]
+	default:
+		return values
+	}
+
+	for _, property := range props {
+		entity, ok := property.Value.(*datastore.Entity)
+
+		if !ok || entity == nil || !strings.HasPrefix(name, property.Name+".") {
+			continue
+		}
+
+		return propertyValue(entity.Properties, strings.TrimPrefix(name, property.Name+"."))
+	}
+
+	return nil
+}
+
+// restore converts the saved property value back to the Go type of the
+// field. The datastore saves all integers as int64 and all floats as
+// float64, while the hashes are calculated from the values of the fields.
+func restore(value interface{}, t reflect.Type) interface{} {
+	if value == nil || t == nil {
+		return value
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return value
+		}
+
+		result := reflect.MakeSlice(reflect.SliceOf(t.Elem()), 0, len(list))
+
+		for _, item := range list {
+			element := reflect.ValueOf(restore(item, t.Elem()))
+
+			if !element.IsValid() || !element.Type().AssignableTo(t.Elem()) {
+				return value
+			}
+
+			result = reflect.Append(result, element)
+		}
+
+		return result.Interface()
+	}
+
+	v := reflect.ValueOf(value)
+
+	if numeric(v.Kind()) && numeric(t.Kind()) {
+		return v.Convert(t).Interface()
+	}
+
+	return value
+}
+
+func elemOf(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return nil
+	}
+
+	return t.Elem()
+}
+
+func numeric(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// properties returns the datastore properties of the entity
+func properties(v reflect.Value) ([]datastore.Property, error) {
+	if v.Kind() != reflect.Ptr {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+
+	for v.Elem().Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch entity := v.Interface().(type) {
+	case datastore.PropertyLoadSaver:
+		return entity.Save()
+	default:
+		return datastore.SaveStruct(entity)
+	}
+}
+
+func sparse(values []interface{}) bool {
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+
+		if !v.IsValid() || v.IsZero() {
+			return true
+		}
+
+		switch v.Kind() {
+		case reflect.Slice, reflect.Map:
+			if v.Len() == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hash(fingerprint []interface{}) (uint64, error) {
+	return hashstructure.Hash(fingerprint, nil)
 }
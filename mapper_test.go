@@ -1,6 +1,7 @@
 package firestorm_test
 
 import (
+	"fmt"
 	"reflect"
 	"sync"
 
@@ -29,7 +30,39 @@ var _ = Describe("IndexMapper", func() {
 			list := *maptree
 			Expect(list).To(HaveLen(1))
 			Expect(list[0].Name).To(Equal("email"))
-			Expect(list[0].Properties).To(Equal([][]int{[]int{3}}))
+			Expect(list[0].Unique).To(BeTrue())
+			Expect(list[0].Properties).To(Equal([]string{"email"}))
+		})
+
+		Context("when the index is not unique", func() {
+			It("returns the index tree for given type", func() {
+				maptree := mapper.Tree(reflect.TypeOf(Employee{}))
+				Expect(maptree).NotTo(BeNil())
+
+				list := *maptree
+				Expect(list).To(HaveLen(1))
+				Expect(list[0].Name).To(Equal("company"))
+				Expect(list[0].Unique).To(BeFalse())
+				Expect(list[0].Properties).To(Equal([]string{"company"}))
+			})
+		})
+
+		Context("when the type has nested structs", func() {
+			It("returns the index tree for given type", func() {
+				maptree := mapper.Tree(reflect.TypeOf(Company{}))
+				Expect(maptree).NotTo(BeNil())
+
+				list := *maptree
+				Expect(list).To(HaveLen(3))
+				Expect(list[0].Name).To(Equal("created_by"))
+				Expect(list[0].Properties).To(Equal([]string{"created_by"}))
+				Expect(list[1].Name).To(Equal("location"))
+				Expect(list[1].Unique).To(BeTrue())
+				Expect(list[1].Properties).To(Equal([]string{"name", "address.country", "office.country"}))
+				Expect(list[2].Name).To(Equal("postal_code"))
+				Expect(list[2].Unique).To(BeTrue())
+				Expect(list[2].Properties).To(Equal([]string{"address.postal_code", "office.postal_code"}))
+			})
 		})
 
 		Context("when the type is pointer to struct", func() {
@@ -40,7 +73,7 @@ var _ = Describe("IndexMapper", func() {
 				list := *maptree
 				Expect(list).To(HaveLen(1))
 				Expect(list[0].Name).To(Equal("email"))
-				Expect(list[0].Properties).To(Equal([][]int{[]int{3}}))
+				Expect(list[0].Properties).To(Equal([]string{"email"}))
 			})
 		})
 
@@ -61,6 +94,14 @@ var _ = Describe("IndexMapper", func() {
 			})
 		})
 
+		Context("when the type is a property load saver", func() {
+			It("returns an empty tree", func() {
+				maptree := mapper.Tree(reflect.TypeOf(datastore.PropertyList{}))
+				Expect(maptree).NotTo(BeNil())
+				Expect(*maptree).To(BeEmpty())
+			})
+		})
+
 		Context("when the type is not struct", func() {
 			It("returns an empty tree", func() {
 				maptree := mapper.Tree(reflect.TypeOf(0))
@@ -96,9 +137,287 @@ var _ = Describe("IndexTree", func() {
 			Expect(keys).To(HaveLen(1))
 			Expect(keys[0].Key.Name).To(Equal("14491862341308332741"))
 			Expect(keys[0].Key.Kind).To(Equal("entity_email_index"))
+			Expect(keys[0].Owner).To(Equal(entity.ID))
+			Expect(keys[0].Index).To(Equal("email"))
 			Expect(keys[0].Hash).To(Equal(uint64(14491862341308332741)))
 		})
 
+		Context("when the index is not unique", func() {
+			It("returns a key per owner", func() {
+				entity := &Employee{
+					ID:      datastore.NameKey("employee", "007", nil),
+					Name:    "John",
+					Company: "Phogo Labs",
+				}
+
+				mapper := &firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}
+
+				keys, err := mapper.Tree(reflect.TypeOf(entity)).Keys(entity.ID, reflect.ValueOf(entity))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Key.Name).To(Equal(entity.ID.Encode()))
+				Expect(keys[0].Key.Kind).To(Equal("employee_company_index"))
+				Expect(keys[0].Key.Parent).NotTo(BeNil())
+				Expect(keys[0].Key.Parent.Kind).To(Equal("employee_company_index"))
+				Expect(keys[0].Key.Parent.Name).To(Equal(fmt.Sprintf("%v", keys[0].Hash)))
+			})
+		})
+
+		Context("when the index is sparse", func() {
+			var user *User
+
+			BeforeEach(func() {
+				user = &User{
+					ID:    datastore.NameKey("user", "007", nil),
+					Email: "john@example.com",
+				}
+
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(user))
+			})
+
+			It("skips the empty value", func() {
+				keys, err := maptree.Keys(user.ID, reflect.ValueOf(user))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Index).To(Equal("email"))
+			})
+
+			Context("when the value is not empty", func() {
+				BeforeEach(func() {
+					user.Phone = firestorm.String("+359888123456")
+				})
+
+				It("returns the key", func() {
+					keys, err := maptree.Keys(user.ID, reflect.ValueOf(user))
+					Expect(err).To(BeNil())
+					Expect(keys).To(HaveLen(2))
+					Expect(keys[1].Index).To(Equal("phone"))
+				})
+			})
+		})
+
+		Context("when the index is normalized", func() {
+			It("returns the same key for equivalent values", func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&User{}))
+
+				john := &User{
+					ID:    datastore.NameKey("user", "007", nil),
+					Email: "  John@Example.com ",
+				}
+
+				keys, err := maptree.Keys(john.ID, reflect.ValueOf(john))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Values).To(Equal([]interface{}{"john@example.com"}))
+
+				john.Email = "john@example.com"
+
+				next, err := maptree.Keys(john.ID, reflect.ValueOf(john))
+				Expect(err).To(BeNil())
+				Expect(next).To(HaveLen(1))
+				Expect(next[0].Key).To(Equal(keys[0].Key))
+			})
+		})
+
+		Context("when the index has an encoding", func() {
+			It("returns the encoded key", func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&Product{}))
+
+				product := &Product{
+					ID:     datastore.NameKey("product", "007", nil),
+					Vendor: "acme",
+					SKU:    42,
+				}
+
+				keys, err := maptree.Keys(product.ID, reflect.ValueOf(product))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Key.Name).To(Equal(`canonical:s"acme",i42`))
+				Expect(keys[0].Key.Kind).To(Equal("product_sku_index"))
+			})
+		})
+
+		Context("when the index has nested fields", func() {
+			var company *Company
+
+			BeforeEach(func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&Company{}))
+
+				company = &Company{
+					ID:    datastore.NameKey("company", "007", nil),
+					Audit: Audit{CreatedBy: "john"},
+					Name:  "Phogo Labs",
+				}
+			})
+
+			It("returns the keys", func() {
+				keys, err := maptree.Keys(company.ID, reflect.ValueOf(company))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(3))
+				Expect(keys[0].Values).To(Equal([]interface{}{"john"}))
+				Expect(keys[1].Values).To(Equal([]interface{}{"Phogo Labs", nil, ""}))
+				Expect(keys[2].Values).To(Equal([]interface{}{nil, ""}))
+			})
+
+			Context("when the nested struct is set", func() {
+				BeforeEach(func() {
+					company.Address = &Address{Country: "BG", PostalCode: "1000"}
+					company.Office = Address{Country: "UK", PostalCode: "EC1"}
+				})
+
+				It("returns the keys", func() {
+					keys, err := maptree.Keys(company.ID, reflect.ValueOf(company))
+					Expect(err).To(BeNil())
+					Expect(keys).To(HaveLen(3))
+					Expect(keys[1].Values).To(Equal([]interface{}{"Phogo Labs", "BG", "UK"}))
+					Expect(keys[2].Values).To(Equal([]interface{}{"1000", "EC1"}))
+				})
+			})
+		})
+
+		Context("when the index has each option", func() {
+			var account *Account
+
+			BeforeEach(func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&Account{}))
+
+				account = &Account{
+					ID:      datastore.NameKey("account", "007", nil),
+					Emails:  []string{"John@Example.com", "john.doe@example.com"},
+					Aliases: []string{"jd"},
+				}
+			})
+
+			It("returns a key per element", func() {
+				keys, err := maptree.Keys(account.ID, reflect.ValueOf(account))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(3))
+				Expect(keys[0].Index).To(Equal("alias"))
+				Expect(keys[0].Values).To(Equal([]interface{}{"jd"}))
+				Expect(keys[1].Index).To(Equal("email"))
+				Expect(keys[1].Values).To(Equal([]interface{}{"john@example.com"}))
+				Expect(keys[2].Index).To(Equal("email"))
+				Expect(keys[2].Values).To(Equal([]interface{}{"john.doe@example.com"}))
+			})
+
+			It("returns the changed elements only", func() {
+				prev, err := maptree.Keys(account.ID, reflect.ValueOf(account))
+				Expect(err).To(BeNil())
+
+				account.Emails = []string{"john@example.com", "jd@example.com"}
+
+				next, err := maptree.Keys(account.ID, reflect.ValueOf(account))
+				Expect(err).To(BeNil())
+
+				changeset := maptree.Diff(prev, next)
+				Expect(changeset).To(HaveLen(2))
+				Expect(changeset[0].Unchanged).To(HaveLen(1))
+				Expect(changeset[1].Name).To(Equal("email"))
+				Expect(changeset[1].Unchanged).To(HaveLen(1))
+				Expect(changeset[1].Added).To(HaveLen(1))
+				Expect(changeset[1].Added[0].Values).To(Equal([]interface{}{"jd@example.com"}))
+				Expect(changeset[1].Removed).To(HaveLen(1))
+				Expect(changeset[1].Removed[0].Values).To(Equal([]interface{}{"john.doe@example.com"}))
+			})
+
+			Context("when the slices are empty", func() {
+				It("returns no keys", func() {
+					account.Emails = nil
+					account.Aliases = []string{}
+
+					keys, err := maptree.Keys(account.ID, reflect.ValueOf(account))
+					Expect(err).To(BeNil())
+					Expect(keys).To(BeEmpty())
+				})
+
+				It("does not conflict with another entity without elements", func() {
+					var (
+						memory = firestorm.NewMemory()
+						first  = &Account{ID: datastore.NameKey("account", "007", nil)}
+						second = &Account{ID: datastore.NameKey("account", "008", nil), Emails: []string{}}
+					)
+
+					Expect(memory.RunInTransaction(firestorm.NewInsertIndexer(first.ID, first).Index)).To(Succeed())
+					Expect(memory.RunInTransaction(firestorm.NewInsertIndexer(second.ID, second).Index)).To(Succeed())
+				})
+			})
+
+			Context("when the elements are duplicated", func() {
+				BeforeEach(func() {
+					account.Emails = append(account.Emails, "JOHN@example.com")
+				})
+
+				It("returns an error", func() {
+					keys, err := maptree.Keys(account.ID, reflect.ValueOf(account))
+					Expect(err).To(MatchError(`firestorm: account index "email" conflict on emails=john@example.com owned by /account,007`))
+					Expect(keys).To(BeNil())
+				})
+			})
+		})
+
+		Context("when the fields are saved as other types", func() {
+			It("returns the keys of the field values", func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&Score{}))
+
+				score := &Score{
+					ID:     datastore.NameKey("score", "007", nil),
+					Rank:   5,
+					Weight: 1.5,
+					Levels: []int16{1},
+				}
+
+				keys, err := maptree.Keys(score.ID, reflect.ValueOf(score))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(3))
+				Expect(keys[0].Values).To(Equal([]interface{}{int16(1)}))
+				Expect(keys[1].Values).To(Equal([]interface{}{int32(5)}))
+				Expect(keys[1].Key.Name).To(Equal("13495035279442544047"))
+				Expect(keys[2].Values).To(Equal([]interface{}{float32(1.5)}))
+				Expect(keys[2].Key.Name).To(Equal("1528799161120665227"))
+			})
+		})
+
+		Context("when the entity has a custom Save", func() {
+			It("returns the keys of the saved properties", func() {
+				maptree = (&firestorm.IndexMapper{
+					Mutex: &sync.Mutex{},
+					Cache: make(map[reflect.Type]*firestorm.IndexTree),
+				}).Tree(reflect.TypeOf(&Contact{}))
+
+				contact := &Contact{
+					ID:    datastore.NameKey("contact", "007", nil),
+					Email: "John@Example.com",
+				}
+
+				keys, err := maptree.Keys(contact.ID, reflect.ValueOf(contact))
+				Expect(err).To(BeNil())
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].Values).To(Equal([]interface{}{"john@example.com"}))
+				Expect(keys[0].Key.Name).To(Equal("14491862341308332741"))
+			})
+		})
+
 		Context("when the key is nil", func() {
 			It("returns an error", func() {
 				entity := &Entity{
@@ -113,4 +432,65 @@ var _ = Describe("IndexTree", func() {
 			})
 		})
 	})
+
+	Describe("Diff", func() {
+		var (
+			prev   []*firestorm.IndexKey
+			entity *Entity
+		)
+
+		BeforeEach(func() {
+			entity = &Entity{
+				ID:        datastore.NameKey("entity", "007", nil),
+				FirstName: "John",
+				LastName:  "Doe",
+				Email:     "john@example.com",
+			}
+
+			var err error
+
+			prev, err = maptree.Keys(entity.ID, reflect.ValueOf(entity))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the changes per index", func() {
+			entity.Email = "jack@example.com"
+
+			next, err := maptree.Keys(entity.ID, reflect.ValueOf(entity))
+			Expect(err).NotTo(HaveOccurred())
+
+			changeset := maptree.Diff(prev, next)
+			Expect(changeset).To(HaveLen(1))
+			Expect(changeset[0].Name).To(Equal("email"))
+			Expect(changeset[0].Added).To(Equal(next))
+			Expect(changeset[0].Removed).To(Equal(prev))
+			Expect(changeset[0].Unchanged).To(BeEmpty())
+			Expect(changeset[0].String()).To(Equal("email: 1 added, 1 removed, 0 unchanged"))
+
+			Expect(changeset.Added()).To(Equal(next))
+			Expect(changeset.Removed()).To(Equal(prev))
+		})
+
+		Context("when the value is not changed", func() {
+			It("returns the unchanged keys", func() {
+				next, err := maptree.Keys(entity.ID, reflect.ValueOf(entity))
+				Expect(err).NotTo(HaveOccurred())
+
+				changeset := maptree.Diff(prev, next)
+				Expect(changeset).To(HaveLen(1))
+				Expect(changeset[0].Added).To(BeEmpty())
+				Expect(changeset[0].Removed).To(BeEmpty())
+				Expect(changeset[0].Unchanged).To(Equal(next))
+			})
+		})
+
+		Context("when there is no previous state", func() {
+			It("returns the added keys", func() {
+				changeset := maptree.Diff(nil, prev)
+				Expect(changeset).To(HaveLen(1))
+				Expect(changeset[0].Added).To(Equal(prev))
+				Expect(changeset[0].Removed).To(BeEmpty())
+			})
+		})
+	})
 })
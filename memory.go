@@ -0,0 +1,398 @@
+package firestorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+var (
+	// ErrEntityExists is returned by the memory backend when an inserted
+	// entity already exists
+	ErrEntityExists = errors.New("firestorm: entity already exists")
+	// ErrTransactionClosed is returned by a memory transaction that is
+	// already committed or rolled back
+	ErrTransactionClosed = errors.New("firestorm: transaction closed")
+)
+
+// Memory is an in-memory datastore backend for testing the indexers without
+// the datastore emulator
+type Memory struct {
+	Mutex    *sync.Mutex
+	Entities map[string]*MemoryEntity
+	// Version is the version of the last write. Every write takes the next
+	// version, so an entity never gets a version it had before.
+	Version int64
+}
+
+// MemoryEntity represents an entity stored in memory
+type MemoryEntity struct {
+	Key        *datastore.Key
+	Properties []datastore.Property
+	// Version is the version of the last write of the entity
+	Version int64
+	// Deleted is true if the last write deleted the entity. The deleted
+	// entities are kept to detect the concurrent writes.
+	Deleted bool
+}
+
+// NewMemory returns a new empty memory backend
+func NewMemory() *Memory {
+	return &Memory{
+		Mutex:    &sync.Mutex{},
+		Entities: make(map[string]*MemoryEntity),
+	}
+}
+
+// Get loads the committed entity stored for the key into dst
+func (m *Memory) Get(key *datastore.Key, dst interface{}) error {
+	m.Mutex.Lock()
+	entity := m.Entities[key.Encode()]
+	m.Mutex.Unlock()
+
+	if !exists(entity) {
+		return datastore.ErrNoSuchEntity
+	}
+
+	return load(entity, dst)
+}
+
+// NewTransaction starts a new transaction
+func (m *Memory) NewTransaction() *MemoryTransaction {
+	return &MemoryTransaction{
+		memory:   m,
+		versions: make(map[string]int64),
+	}
+}
+
+// RunInTransaction runs the function in a transaction. The transaction is
+// committed if the function returns nil and rolled back otherwise. It is
+// retried up to three times on concurrent modifications.
+func (m *Memory) RunInTransaction(fn func(tx Transaction) error) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		tx := m.NewTransaction()
+
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != datastore.ErrConcurrentTransaction {
+			return err
+		}
+	}
+
+	return datastore.ErrConcurrentTransaction
+}
+
+// MemoryTransaction is a transaction of the memory backend. Like the
+// datastore transactions, it buffers the mutations until it is committed and
+// its reads do not observe them.
+type MemoryTransaction struct {
+	memory    *Memory
+	mutations []*memoryMutation
+	versions  map[string]int64
+	closed    bool
+}
+
+// memoryMutation is a mutation buffered by a memory transaction
+type memoryMutation struct {
+	operation  Operation
+	key        *datastore.Key
+	properties []datastore.Property
+}
+
+// Get loads the entity stored for the key into dst
+func (tx *MemoryTransaction) Get(key *datastore.Key, dst interface{}) error {
+	err := tx.GetMulti([]*datastore.Key{key}, []interface{}{dst})
+
+	if errs, ok := err.(datastore.MultiError); ok {
+		return errs[0]
+	}
+
+	return err
+}
+
+// GetMulti is a batch version of Get. The dst must be a slice of the same
+// length as keys.
+func (tx *MemoryTransaction) GetMulti(keys []*datastore.Key, dst interface{}) error {
+	if tx.closed {
+		return ErrTransactionClosed
+	}
+
+	value := reflect.ValueOf(dst)
+
+	if value.Kind() != reflect.Slice || value.Len() != len(keys) {
+		return fmt.Errorf("firestorm: dst must be a slice of %d elements", len(keys))
+	}
+
+	var (
+		errs   = make(datastore.MultiError, len(keys))
+		failed = false
+	)
+
+	for index, key := range keys {
+		if key == nil || key.Incomplete() {
+			return datastore.ErrInvalidKey
+		}
+
+		name := key.Encode()
+
+		tx.memory.Mutex.Lock()
+		entity := tx.memory.Entities[name]
+		tx.memory.Mutex.Unlock()
+
+		if _, ok := tx.versions[name]; !ok {
+			tx.versions[name] = versionOf(entity)
+		}
+
+		if !exists(entity) {
+			errs[index] = datastore.ErrNoSuchEntity
+			failed = true
+			continue
+		}
+
+		if errs[index] = load(entity, target(value.Index(index))); errs[index] != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		return errs
+	}
+
+	return nil
+}
+
+// Apply buffers the mutations of the changeset until the transaction is
+// committed. The entities are saved when they are applied, as the datastore
+// mutations do.
+func (tx *MemoryTransaction) Apply(changes *Changeset) error {
+	if tx.closed {
+		return ErrTransactionClosed
+	}
+
+	mutations := []*memoryMutation{}
+
+	add := func(operation Operation, key *datastore.Key, src interface{}) error {
+		if key == nil || key.Incomplete() {
+			return datastore.ErrInvalidKey
+		}
+
+		mutation := &memoryMutation{operation: operation, key: key}
+
+		if operation != DeleteOperation {
+			properties, err := save(src)
+			if err != nil {
+				return err
+			}
+
+			mutation.properties = properties
+		}
+
+		mutations = append(mutations, mutation)
+		return nil
+	}
+
+	for _, entity := range changes.Entities {
+		if err := add(entity.Operation, entity.Key, entity.Entity); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range changes.Insert {
+		if err := add(InsertOperation, key.Key, key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range changes.Upsert {
+		if err := add(UpsertOperation, key.Key, key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range changes.Delete {
+		if err := add(DeleteOperation, key, nil); err != nil {
+			return err
+		}
+	}
+
+	tx.mutations = append(tx.mutations, mutations...)
+	return nil
+}
+
+// Delete deletes the entity for the key when the transaction is committed
+func (tx *MemoryTransaction) Delete(key *datastore.Key) error {
+	return tx.Apply(&Changeset{Delete: []*datastore.Key{key}})
+}
+
+// Commit applies the mutations atomically. It fails with
+// datastore.ErrConcurrentTransaction if an entity read by the
+// transaction was modified since, with ErrEntityExists if an inserted entity
+// exists and with datastore.ErrNoSuchEntity if an updated entity is missing.
+func (tx *MemoryTransaction) Commit() error {
+	if tx.closed {
+		return ErrTransactionClosed
+	}
+
+	tx.closed = true
+
+	tx.memory.Mutex.Lock()
+	defer tx.memory.Mutex.Unlock()
+
+	entities := tx.memory.Entities
+
+	for name, version := range tx.versions {
+		if versionOf(entities[name]) != version {
+			return datastore.ErrConcurrentTransaction
+		}
+	}
+
+	var (
+		staged  = make(map[string]*MemoryEntity)
+		version = tx.memory.Version
+	)
+
+	current := func(name string) *MemoryEntity {
+		if entity, ok := staged[name]; ok {
+			return entity
+		}
+
+		return entities[name]
+	}
+
+	for _, mutation := range tx.mutations {
+		name := mutation.key.Encode()
+
+		switch mutation.operation {
+		case InsertOperation:
+			if exists(current(name)) {
+				return ErrEntityExists
+			}
+		case UpdateOperation:
+			if !exists(current(name)) {
+				return datastore.ErrNoSuchEntity
+			}
+		}
+
+		version++
+
+		staged[name] = &MemoryEntity{
+			Key:        mutation.key,
+			Properties: mutation.properties,
+			Version:    version,
+			Deleted:    mutation.operation == DeleteOperation,
+		}
+	}
+
+	for name, entity := range staged {
+		entities[name] = entity
+	}
+
+	tx.memory.Version = version
+	return nil
+}
+
+// Rollback discards the mutations
+func (tx *MemoryTransaction) Rollback() error {
+	if tx.closed {
+		return ErrTransactionClosed
+	}
+
+	tx.closed = true
+	tx.mutations = nil
+	return nil
+}
+
+func exists(entity *MemoryEntity) bool {
+	return entity != nil && !entity.Deleted
+}
+
+func versionOf(entity *MemoryEntity) int64 {
+	if entity == nil {
+		return 0
+	}
+
+	return entity.Version
+}
+
+// target returns the pointer that an element of a GetMulti slice is loaded
+// into
+func target(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+
+		return value.Interface()
+	case reflect.Interface:
+		return value.Elem().Interface()
+	default:
+		return value.Addr().Interface()
+	}
+}
+
+// save returns the properties of the entity as the datastore client saves
+// them
+func save(src interface{}) ([]datastore.Property, error) {
+	var (
+		properties []datastore.Property
+		err        error
+	)
+
+	if pls, ok := src.(datastore.PropertyLoadSaver); ok {
+		properties, err = pls.Save()
+	} else {
+		properties, err = datastore.SaveStruct(src)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []datastore.Property{}
+
+	// the key is not stored as a property
+	for _, property := range properties {
+		if property.Name != "__key__" {
+			result = append(result, property)
+		}
+	}
+
+	return result, nil
+}
+
+// load loads the entity into dst as the datastore client does
+func load(entity *MemoryEntity, dst interface{}) error {
+	if pls, ok := dst.(datastore.PropertyLoadSaver); ok {
+		if err := pls.Load(entity.Properties); err != nil {
+			return err
+		}
+
+		if loader, ok := dst.(datastore.KeyLoader); ok {
+			return loader.LoadKey(entity.Key)
+		}
+
+		return nil
+	}
+
+	if err := datastore.LoadStruct(dst, entity.Properties); err != nil {
+		return err
+	}
+
+	// the key is loaded into the __key__ field if the struct has one
+	key := []datastore.Property{{Name: "__key__", Value: entity.Key}}
+
+	if err := datastore.LoadStruct(dst, key); err != nil {
+		if _, ok := err.(*datastore.ErrFieldMismatch); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package firestorm_test
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	var (
+		memory *firestorm.Memory
+		entity *Entity
+	)
+
+	BeforeEach(func() {
+		memory = firestorm.NewMemory()
+
+		entity = &Entity{
+			ID:        datastore.NameKey("entity", "007", nil),
+			FirstName: "John",
+			Email:     "john@example.com",
+		}
+	})
+
+	mutation := func(operation firestorm.Operation, key *datastore.Key, src interface{}) *firestorm.EntityMutation {
+		return &firestorm.EntityMutation{Operation: operation, Key: key, Entity: src}
+	}
+
+	apply := func(mutations ...*firestorm.EntityMutation) error {
+		return memory.RunInTransaction(func(tx firestorm.Transaction) error {
+			return tx.Apply(&firestorm.Changeset{Entities: mutations})
+		})
+	}
+
+	insert := func(key *datastore.Key, src interface{}) error {
+		return apply(mutation(firestorm.InsertOperation, key, src))
+	}
+
+	It("stores the entity", func() {
+		Expect(insert(entity.ID, entity)).To(Succeed())
+
+		stored := &Entity{}
+		Expect(memory.Get(entity.ID, stored)).To(Succeed())
+		Expect(stored).To(Equal(entity))
+	})
+
+	Context("when the inserted entity exists", func() {
+		It("returns an error", func() {
+			Expect(insert(entity.ID, entity)).To(Succeed())
+			Expect(insert(entity.ID, entity)).To(MatchError(firestorm.ErrEntityExists))
+		})
+	})
+
+	Context("when the updated entity does not exist", func() {
+		It("returns an error", func() {
+			err := apply(mutation(firestorm.UpdateOperation, entity.ID, entity))
+			Expect(err).To(Equal(datastore.ErrNoSuchEntity))
+		})
+	})
+
+	Context("when the entity does not exist", func() {
+		It("returns an error", func() {
+			tx := memory.NewTransaction()
+			Expect(tx.Get(entity.ID, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+
+			entities := make([]*Entity, 1)
+			err := tx.GetMulti([]*datastore.Key{entity.ID}, entities)
+			Expect(err).To(Equal(datastore.MultiError{datastore.ErrNoSuchEntity}))
+		})
+	})
+
+	Context("when the transaction fails", func() {
+		It("rolls back the mutations", func() {
+			err := memory.RunInTransaction(func(tx firestorm.Transaction) error {
+				changes := &firestorm.Changeset{
+					Entities: []*firestorm.EntityMutation{mutation(firestorm.InsertOperation, entity.ID, entity)},
+				}
+
+				if err := tx.Apply(changes); err != nil {
+					return err
+				}
+
+				return fmt.Errorf("oh no")
+			})
+
+			Expect(err).To(MatchError("oh no"))
+			Expect(memory.Get(entity.ID, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+
+		It("does not apply any of the mutations", func() {
+			Expect(insert(entity.ID, entity)).To(Succeed())
+
+			other := datastore.NameKey("entity", "008", nil)
+
+			err := apply(
+				mutation(firestorm.InsertOperation, other, entity),
+				mutation(firestorm.InsertOperation, entity.ID, entity),
+			)
+
+			Expect(err).To(MatchError(firestorm.ErrEntityExists))
+			Expect(memory.Get(other, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+	})
+
+	Context("when a read entity is modified concurrently", func() {
+		It("returns an error", func() {
+			tx := memory.NewTransaction()
+			Expect(tx.Get(entity.ID, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+			Expect(insert(entity.ID, entity)).To(Succeed())
+
+			changes := &firestorm.Changeset{
+				Entities: []*firestorm.EntityMutation{mutation(firestorm.UpsertOperation, entity.ID, entity)},
+			}
+
+			Expect(tx.Apply(changes)).To(Succeed())
+			Expect(tx.Commit()).To(Equal(datastore.ErrConcurrentTransaction))
+		})
+
+		Context("when the entity is deleted and inserted again", func() {
+			It("returns an error", func() {
+				Expect(insert(entity.ID, entity)).To(Succeed())
+
+				tx := memory.NewTransaction()
+				Expect(tx.Get(entity.ID, &Entity{})).To(Succeed())
+
+				Expect(apply(mutation(firestorm.DeleteOperation, entity.ID, nil))).To(Succeed())
+				Expect(insert(entity.ID, entity)).To(Succeed())
+
+				changes := &firestorm.Changeset{
+					Entities: []*firestorm.EntityMutation{mutation(firestorm.UpdateOperation, entity.ID, entity)},
+				}
+
+				Expect(tx.Apply(changes)).To(Succeed())
+				Expect(tx.Commit()).To(Equal(datastore.ErrConcurrentTransaction))
+			})
+		})
+
+		Context("when the missing entity is inserted and deleted", func() {
+			It("returns an error", func() {
+				tx := memory.NewTransaction()
+				Expect(tx.Get(entity.ID, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+
+				Expect(insert(entity.ID, entity)).To(Succeed())
+				Expect(apply(mutation(firestorm.DeleteOperation, entity.ID, nil))).To(Succeed())
+
+				Expect(tx.Delete(entity.ID)).To(Succeed())
+				Expect(tx.Commit()).To(Equal(datastore.ErrConcurrentTransaction))
+			})
+		})
+	})
+
+	Context("when a custom indexer writes an entity", func() {
+		It("applies its changeset with the ones of the engine", func() {
+			other := datastore.NameKey("audit", "007", nil)
+
+			custom := firestorm.IndexerFunc(func(tx firestorm.Transaction) error {
+				return tx.Apply(&firestorm.Changeset{
+					Entities: []*firestorm.EntityMutation{mutation(firestorm.InsertOperation, other, &Audit{CreatedBy: "john"})},
+				})
+			})
+
+			indexer := firestorm.Chain(firestorm.NewInsertWriter(entity.ID, entity), custom)
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+			Expect(memory.Get(entity.ID, &Entity{})).To(Succeed())
+			Expect(memory.Get(other, &Audit{})).To(Succeed())
+		})
+	})
+
+	Context("when the transaction is closed", func() {
+		It("returns an error", func() {
+			tx := memory.NewTransaction()
+			Expect(tx.Rollback()).To(Succeed())
+			Expect(tx.Commit()).To(MatchError(firestorm.ErrTransactionClosed))
+		})
+	})
+
+	Describe("Indexers", func() {
+		index := func(indexer firestorm.Indexer) error {
+			return memory.RunInTransaction(indexer.Index)
+		}
+
+		emailKey := datastore.NameKey("entity_email_index", "14491862341308332741", nil)
+
+		It("inserts the index", func() {
+			Expect(index(firestorm.NewInsertIndexer(entity.ID, entity))).To(Succeed())
+
+			key := &firestorm.IndexKey{}
+			Expect(memory.Get(emailKey, key)).To(Succeed())
+			Expect(key.Owner).To(Equal(entity.ID))
+			Expect(key.Index).To(Equal("email"))
+		})
+
+		Context("when the value is owned by another entity", func() {
+			It("returns a conflict error", func() {
+				Expect(index(firestorm.NewInsertIndexer(entity.ID, entity))).To(Succeed())
+
+				other := &Entity{
+					ID:    datastore.NameKey("entity", "008", nil),
+					Email: entity.Email,
+				}
+
+				err := index(firestorm.NewInsertIndexer(other.ID, other))
+
+				conflict := &firestorm.IndexConflictError{}
+				Expect(errors.As(err, &conflict)).To(BeTrue())
+				Expect(conflict.Owner).To(Equal(entity.ID))
+			})
+		})
+
+		It("updates the index", func() {
+			Expect(insert(entity.ID, entity)).To(Succeed())
+			Expect(index(firestorm.NewInsertIndexer(entity.ID, entity))).To(Succeed())
+
+			entity.Email = "jane@example.com"
+			Expect(index(firestorm.NewUpdateIndexer(entity.ID, entity))).To(Succeed())
+			Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+
+		It("deletes the index", func() {
+			Expect(insert(entity.ID, entity)).To(Succeed())
+			Expect(index(firestorm.NewInsertIndexer(entity.ID, entity))).To(Succeed())
+			Expect(index(firestorm.NewDeleteIndexer(entity.ID, &Entity{}))).To(Succeed())
+			Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package firestorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Normalizer normalizes an indexed value before it is hashed
+type Normalizer func(value interface{}) (interface{}, error)
+
+var normalizers = &NormalizerRegistry{
+	Mutex: &sync.RWMutex{},
+	Registry: map[string]Normalizer{
+		"lower": StringNormalizer(strings.ToLower),
+		"upper": StringNormalizer(strings.ToUpper),
+		"trim":  StringNormalizer(strings.TrimSpace),
+	},
+}
+
+// NormalizerRegistry represents the registry of named normalizers
+type NormalizerRegistry struct {
+	Mutex    *sync.RWMutex
+	Registry map[string]Normalizer
+}
+
+// Register registers a normalizer with the given name
+func (r *NormalizerRegistry) Register(name string, fn Normalizer) {
+	r.Mutex.Lock()
+	r.Registry[name] = fn
+	r.Mutex.Unlock()
+}
+
+// Normalize applies the named normalizers to the value in order
+func (r *NormalizerRegistry) Normalize(value interface{}, names ...string) (interface{}, error) {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+
+	for _, name := range names {
+		fn, ok := r.Registry[name]
+		if !ok {
+			return nil, fmt.Errorf("firestorm: unknown normalizer %q", name)
+		}
+
+		var err error
+
+		if value, err = fn(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// RegisterNormalizer registers a normalizer with the given name. The name can
+// be used as an option of the index tag, e.g. `index:"phone,unique,e164"`.
+func RegisterNormalizer(name string, fn Normalizer) {
+	normalizers.Register(name, fn)
+}
+
+// Normalize applies the named normalizers to the value in order. It can be
+// used to normalize values before they are passed to LookupByIndex.
+func Normalize(value interface{}, names ...string) (interface{}, error) {
+	return normalizers.Normalize(value, names...)
+}
+
+// StringNormalizer returns a normalizer that applies fn to string and string
+// pointer values. The other values are returned unchanged.
+func StringNormalizer(fn func(string) string) Normalizer {
+	return func(value interface{}) (interface{}, error) {
+		v := reflect.ValueOf(value)
+
+		switch {
+		case v.Kind() == reflect.String:
+			return reflect.ValueOf(fn(v.String())).Convert(v.Type()).Interface(), nil
+		case v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.String:
+			next := reflect.New(v.Elem().Type())
+			next.Elem().SetString(fn(v.Elem().String()))
+			return next.Interface(), nil
+		default:
+			return value, nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package firestorm_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Normalize", func() {
+	It("applies the normalizers in order", func() {
+		value, err := firestorm.Normalize("  John@Example.com ", "trim", "lower")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("john@example.com"))
+	})
+
+	Context("when the value is a string pointer", func() {
+		It("returns a normalized copy", func() {
+			email := firestorm.String("John@Example.com")
+
+			value, err := firestorm.Normalize(email, "lower")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal(firestorm.String("john@example.com")))
+			Expect(*email).To(Equal("John@Example.com"))
+		})
+	})
+
+	Context("when the value is not a string", func() {
+		It("returns the value", func() {
+			value, err := firestorm.Normalize(42, "lower")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal(42))
+		})
+	})
+
+	Context("when the normalizer is registered", func() {
+		BeforeEach(func() {
+			firestorm.RegisterNormalizer("digits", firestorm.StringNormalizer(func(v string) string {
+				return strings.Map(func(r rune) rune {
+					if r >= '0' && r <= '9' {
+						return r
+					}
+					return -1
+				}, v)
+			}))
+
+			firestorm.RegisterNormalizer("fail", func(value interface{}) (interface{}, error) {
+				return nil, fmt.Errorf("oh no")
+			})
+		})
+
+		It("applies the normalizer", func() {
+			value, err := firestorm.Normalize("+359 (888) 123-456", "digits")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("359888123456"))
+		})
+
+		It("returns the normalizer error", func() {
+			value, err := firestorm.Normalize("john", "fail")
+			Expect(err).To(MatchError("oh no"))
+			Expect(value).To(BeNil())
+		})
+	})
+
+	Context("when the normalizer is unknown", func() {
+		It("returns an error", func() {
+			value, err := firestorm.Normalize("john", "unknown")
+			Expect(err).To(MatchError(`firestorm: unknown normalizer "unknown"`))
+			Expect(value).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,300 @@
+package firestorm
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Operation is the operation of an entity mutation
+type Operation string
+
+const (
+	// InsertOperation inserts the entity and fails if it exists
+	InsertOperation Operation = "insert"
+	// UpdateOperation updates the entity and fails if it is missing
+	UpdateOperation Operation = "update"
+	// UpsertOperation inserts or updates the entity
+	UpsertOperation Operation = "upsert"
+	// DeleteOperation deletes the entity
+	DeleteOperation Operation = "delete"
+)
+
+// EntityMutation represents the mutation of an entity written by a writer
+type EntityMutation struct {
+	Operation Operation
+	Key       *datastore.Key
+	// Entity is the written entity. It is nil for the deletes.
+	Entity interface{}
+}
+
+// Mutation returns the datastore mutation
+func (m *EntityMutation) Mutation() *datastore.Mutation {
+	switch m.Operation {
+	case InsertOperation:
+		return datastore.NewInsert(m.Key, m.Entity)
+	case UpdateOperation:
+		return datastore.NewUpdate(m.Key, m.Entity)
+	case UpsertOperation:
+		return datastore.NewUpsert(m.Key, m.Entity)
+	default:
+		return datastore.NewDelete(m.Key)
+	}
+}
+
+// Changeset represents the mutations of an indexer
+type Changeset struct {
+	// Entities are the mutations of the entities written by writers
+	Entities []*EntityMutation
+	// Insert are the unique index keys to insert
+	Insert []*IndexKey
+	// Upsert are the non-unique index keys and the unique ones whose values
+	// are released and claimed again within the same write
+	Upsert []*IndexKey
+	// Delete are the keys of the index entities to delete
+	Delete []*datastore.Key
+}
+
+// Len returns the number of the mutations
+func (c *Changeset) Len() int {
+	return len(c.Entities) + len(c.Insert) + len(c.Upsert) + len(c.Delete)
+}
+
+// Mutations returns the mutations that apply the changeset
+func (c *Changeset) Mutations() []*datastore.Mutation {
+	ops := []*datastore.Mutation{}
+
+	for _, entity := range c.Entities {
+		ops = append(ops, entity.Mutation())
+	}
+
+	for _, key := range c.Insert {
+		ops = append(ops, datastore.NewInsert(key.Key, key))
+	}
+
+	for _, key := range c.Upsert {
+		ops = append(ops, datastore.NewUpsert(key.Key, key))
+	}
+
+	for _, key := range c.Delete {
+		ops = append(ops, datastore.NewDelete(key))
+	}
+
+	return ops
+}
+
+// append appends the mutations of the other changeset
+func (c *Changeset) append(other *Changeset) {
+	c.Entities = append(c.Entities, other.Entities...)
+	c.Insert = append(c.Insert, other.Insert...)
+	c.Upsert = append(c.Upsert, other.Upsert...)
+	c.Delete = append(c.Delete, other.Delete...)
+}
+
+// Planner represents an indexer that returns its changeset instead of
+// applying it. The indexers of the engine are planners.
+type Planner interface {
+	Plan(reader Reader) (*Changeset, error)
+}
+
+// Plan returns the changeset of the indexer without applying it. The reader
+// is used to read the stored state, so it is usually a transaction that the
+// changeset is applied in later.
+func Plan(reader Reader, indexer Indexer) (*Changeset, error) {
+	planner, ok := indexer.(Planner)
+	if !ok {
+		return nil, fmt.Errorf("firestorm: indexer %T cannot be planned", indexer)
+	}
+
+	return planner.Plan(reader)
+}
+
+// mutator returns the index changes of an indexer
+type mutator func(reader Reader) (IndexChangeset, error)
+
+// planner is an indexer that applies the entity mutation, if any, and the
+// index mutations with a single Mutate call. A merged planner plans the index
+// changes of its parts together.
+type planner struct {
+	entity func() *EntityMutation
+	fn     mutator
+	parts  []*planner
+}
+
+// writer returns a planner of the mutator. The entity mutation is optional.
+func writer(entity func() *EntityMutation, fn mutator) Indexer {
+	return &planner{entity: entity, fn: fn}
+}
+
+// Plan returns the changeset of the indexer
+func (p *planner) Plan(reader Reader) (*Changeset, error) {
+	changeset, entities, err := p.changes(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := plan(reader, changeset, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	changes.Entities = entities
+
+	if err := limit(changes.Len()); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// changes returns the index changes and the entity mutations of the planner
+// and its parts
+func (p *planner) changes(reader Reader) (IndexChangeset, []*EntityMutation, error) {
+	var (
+		changeset = IndexChangeset{}
+		entities  = []*EntityMutation{}
+	)
+
+	if p.fn != nil {
+		next, err := p.fn(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		changeset = append(changeset, next...)
+	}
+
+	if p.entity != nil {
+		entities = append(entities, p.entity())
+	}
+
+	for _, part := range p.parts {
+		next, mutations, err := part.changes(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		changeset = append(changeset, next...)
+		entities = append(entities, mutations...)
+	}
+
+	return changeset, entities, nil
+}
+
+// Index applies the changeset of the indexer
+func (p *planner) Index(tx Transaction) error {
+	changes, err := p.Plan(tx)
+	if err != nil || changes.Len() == 0 {
+		return err
+	}
+
+	return tx.Apply(changes)
+}
+
+// plan returns the changeset that applies the given index changes.
+// It returns *IndexConflictError if a unique value is owned by another entity.
+// If conflicts is not nil, the conflicts are collected in it instead and the
+// conflicting index keys are left out of the changeset.
+func plan(reader Reader, changeset IndexChangeset, conflicts *[]*IndexConflictError) (*Changeset, error) {
+	var (
+		changes  = &Changeset{}
+		unique   = []*IndexKey{}
+		names    = []*datastore.Key{}
+		claims   = make(map[string]*IndexKey)
+		released = make(map[string]bool)
+	)
+
+	fail := func(err *IndexConflictError) error {
+		if conflicts == nil {
+			return err
+		}
+
+		*conflicts = append(*conflicts, err)
+		return nil
+	}
+
+	for _, key := range changeset.Removed() {
+		released[key.Key.Encode()] = true
+	}
+
+	for _, key := range changeset.Added() {
+		name := key.Key.Encode()
+
+		// the non-unique index keys include the owner, so they never conflict
+		if key.index == nil || !key.index.Unique {
+			if _, ok := claims[name]; !ok {
+				claims[name] = key
+				delete(released, name)
+				changes.Upsert = append(changes.Upsert, key)
+			}
+
+			continue
+		}
+
+		// the same value claimed twice within the same write
+		if claim, ok := claims[name]; ok {
+			if claim.Owner.Equal(key.Owner) {
+				continue
+			}
+
+			if err := fail(conflict(key, claim.Owner)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		claims[name] = key
+
+		// the value is released within the same write
+		if released[name] {
+			delete(released, name)
+			changes.Upsert = append(changes.Upsert, key)
+			continue
+		}
+
+		unique = append(unique, key)
+		names = append(names, key.Key)
+	}
+
+	for _, key := range changeset.Removed() {
+		if name := key.Key.Encode(); released[name] {
+			delete(released, name)
+			changes.Delete = append(changes.Delete, key.Key)
+		}
+	}
+
+	if len(unique) == 0 {
+		return changes, nil
+	}
+
+	var (
+		existing = make([]*IndexKey, len(unique))
+		errs     = make(datastore.MultiError, len(unique))
+	)
+
+	switch err := reader.GetMulti(names, existing).(type) {
+	case nil:
+	case datastore.MultiError:
+		errs = err
+	default:
+		return nil, err
+	}
+
+	for index, key := range unique {
+		switch err := errs[index]; {
+		case err == datastore.ErrNoSuchEntity:
+			changes.Insert = append(changes.Insert, key)
+		case err != nil:
+			return nil, err
+		case existing[index].Owner != nil && existing[index].Owner.Equal(key.Owner):
+			// the index is already owned by the entity
+		default:
+			if err := fail(conflict(key, existing[index].Owner)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,120 @@
+package firestorm_test
+
+import (
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plan", func() {
+	var (
+		memory *firestorm.Memory
+		entity *Entity
+	)
+
+	BeforeEach(func() {
+		memory = firestorm.NewMemory()
+
+		entity = &Entity{
+			ID:    datastore.NameKey("entity", "007", nil),
+			Email: "john@example.com",
+		}
+	})
+
+	It("returns the changeset without applying it", func() {
+		tx := memory.NewTransaction()
+
+		changes, err := firestorm.Plan(tx, firestorm.NewInsertIndexer(entity.ID, entity))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Entities).To(BeEmpty())
+		Expect(changes.Insert).To(HaveLen(1))
+		Expect(changes.Insert[0].Key.Kind).To(Equal("entity_email_index"))
+		Expect(changes.Insert[0].Owner).To(Equal(entity.ID))
+		Expect(changes.Mutations()).To(HaveLen(1))
+
+		Expect(tx.Commit()).To(Succeed())
+		Expect(memory.Get(changes.Insert[0].Key, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+	})
+
+	It("returns the index keys to delete", func() {
+		err := memory.RunInTransaction(firestorm.NewInsertWriter(entity.ID, entity).Index)
+		Expect(err).NotTo(HaveOccurred())
+
+		changes, err := firestorm.Plan(memory.NewTransaction(), firestorm.NewDeleteIndexer(entity.ID, &Entity{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Delete).To(ConsistOf(datastore.NameKey("entity_email_index", "14491862341308332741", nil)))
+	})
+
+	Context("when the index is not unique", func() {
+		It("upserts the index keys", func() {
+			employee := &Employee{
+				ID:      datastore.NameKey("employee", "007", nil),
+				Company: "MI6",
+			}
+
+			indexer := firestorm.NewInsertIndexer(employee.ID, employee)
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+
+			changes, err := firestorm.Plan(memory.NewTransaction(), indexer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Insert).To(BeEmpty())
+			Expect(changes.Upsert).To(HaveLen(1))
+
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+		})
+	})
+
+	Context("when the entities are in different namespaces", func() {
+		var keys []*datastore.Key
+
+		BeforeEach(func() {
+			keys = []*datastore.Key{
+				{Kind: "entity", Name: "007", Namespace: "tenant-a"},
+				{Kind: "entity", Name: "007", Namespace: "tenant-b"},
+			}
+		})
+
+		It("does not conflict on the same value", func() {
+			entities := []*Entity{
+				{ID: keys[0], Email: entity.Email},
+				{ID: keys[1], Email: entity.Email},
+			}
+
+			changes, err := firestorm.Plan(memory.NewTransaction(), firestorm.NewBatchInsertIndexer(keys, entities))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Insert).To(HaveLen(2))
+			Expect(changes.Insert[0].Key.Namespace).NotTo(Equal(changes.Insert[1].Key.Namespace))
+		})
+
+		It("merges the indexers", func() {
+			indexer := firestorm.Merge(
+				firestorm.NewInsertIndexer(keys[0], &Entity{ID: keys[0], Email: entity.Email}),
+				firestorm.NewInsertIndexer(keys[1], &Entity{ID: keys[1], Email: entity.Email}),
+			)
+
+			Expect(memory.RunInTransaction(indexer.Index)).To(Succeed())
+		})
+	})
+
+	Context("when the indexer is a writer", func() {
+		It("returns the entity mutation", func() {
+			changes, err := firestorm.Plan(memory.NewTransaction(), firestorm.NewInsertWriter(entity.ID, entity))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Entities).To(HaveLen(1))
+			Expect(changes.Len()).To(Equal(2))
+		})
+	})
+
+	Context("when the indexer cannot be planned", func() {
+		It("returns an error", func() {
+			indexer := firestorm.IndexerFunc(func(tx firestorm.Transaction) error {
+				return nil
+			})
+
+			_, err := firestorm.Plan(memory.NewTransaction(), indexer)
+			Expect(err).To(MatchError("firestorm: indexer firestorm.IndexerFunc cannot be planned"))
+		})
+	})
+})
@@ -1,6 +1,11 @@
 package firestorm
 
-import "cloud.google.com/go/datastore"
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
 
 // Query is the query condition
 type Query struct {
@@ -36,3 +41,37 @@ func (w *Query) Build(query *datastore.Query) (*datastore.Query, error) {
 
 	return query, nil
 }
+
+// pages runs the keys-only query and calls fn with the keys in pages of the
+// given size, so the keys are never loaded all at once
+func pages(ctx context.Context, client *datastore.Client, query *datastore.Query, size int, fn func(keys []*datastore.Key) error) error {
+	var (
+		iter = client.Run(ctx, query)
+		page = []*datastore.Key{}
+	)
+
+	for {
+		key, err := iter.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if page = append(page, key); len(page) == size {
+			if err := fn(page); err != nil {
+				return err
+			}
+
+			page = []*datastore.Key{}
+		}
+	}
+
+	if len(page) == 0 {
+		return nil
+	}
+
+	return fn(page)
+}
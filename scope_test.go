@@ -0,0 +1,86 @@
+package firestorm_test
+
+import (
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scope", func() {
+	var (
+		project *Project
+		maptree *firestorm.IndexTree
+	)
+
+	BeforeEach(func() {
+		var (
+			root   = &datastore.Key{Kind: "tenant", Name: "acme", Namespace: "eu"}
+			parent = &datastore.Key{Kind: "organization", Name: "r&d", Namespace: "eu", Parent: root}
+		)
+
+		project = &Project{
+			ID:   &datastore.Key{Kind: "project", Name: "007", Namespace: "eu", Parent: parent},
+			Name: "firestorm",
+			Code: "fs",
+		}
+
+		maptree = firestorm.DefaultEngine().Mapper.Tree(reflect.TypeOf(project))
+	})
+
+	keys := func(options *firestorm.KeyOptions) map[string]*firestorm.IndexKey {
+		keys, err := maptree.KeysOf(project.ID, reflect.ValueOf(project), options)
+		Expect(err).NotTo(HaveOccurred())
+
+		index := map[string]*firestorm.IndexKey{}
+
+		for _, key := range keys {
+			index[key.Index] = key
+		}
+
+		return index
+	}
+
+	It("places the index entities under the ancestor", func() {
+		index := keys(&firestorm.KeyOptions{})
+		Expect(index["name"].Key.Parent).To(Equal(project.ID.Parent))
+		Expect(index["code"].Key.Parent).To(Equal(project.ID.Parent.Parent))
+	})
+
+	It("keeps the index entities in the namespace of the ancestor", func() {
+		index := keys(&firestorm.KeyOptions{Namespace: "indexes"})
+		Expect(index["name"].Key.Namespace).To(Equal("eu"))
+		Expect(index["code"].Key.Namespace).To(Equal("eu"))
+	})
+
+	Context("when the entity has no ancestor", func() {
+		BeforeEach(func() {
+			project.ID = datastore.NameKey("project", "007", nil)
+		})
+
+		It("returns an error", func() {
+			keys, err := maptree.KeysOf(project.ID, reflect.ValueOf(project), &firestorm.KeyOptions{})
+			Expect(err).To(MatchError(`firestorm: index "code" is scoped to the root of /project,007 which has none`))
+			Expect(keys).To(BeNil())
+		})
+
+		It("returns an error for the parent scope", func() {
+			index := &firestorm.Index{Name: "name", Unique: true, Scope: firestorm.ParentScope}
+
+			_, err := (&firestorm.KeyOptions{}).Key(project.ID, index, []interface{}{"firestorm"})
+			Expect(err).To(MatchError(`firestorm: index "name" is scoped to the parent of /project,007 which has none`))
+		})
+	})
+
+	Context("when the scope is unknown", func() {
+		It("returns an error", func() {
+			index := &firestorm.Index{Name: "name", Unique: true, Scope: "tenant"}
+
+			_, err := (&firestorm.KeyOptions{}).Key(project.ID, index, []interface{}{"firestorm"})
+			Expect(err).To(MatchError(`firestorm: unknown index scope "tenant"`))
+		})
+	})
+})
@@ -0,0 +1,94 @@
+package firestorm
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/fatih/structtag"
+)
+
+// IndexSpec represents an index defined without struct tags
+type IndexSpec struct {
+	// Name is the name of the index
+	Name string
+	// Fields are the indexed fields. A field is either a Go field name or a
+	// datastore property name. The nested fields are separated with a dot.
+	Fields []string
+	// Unique is true when the index allows a single entity per value
+	Unique bool
+	// Sparse is true when the index skips entities that have an empty value
+	Sparse bool
+	// Each is true when the elements of the slice fields are indexed one by one
+	Each bool
+	// Normalizers are the names of the normalizers applied to every field
+	Normalizers []string
+	// Encoding is the encoding of the index key names
+	Encoding string
+	// Scope is the ancestor that the values are unique within
+	Scope string
+}
+
+// Index returns the index of the spec for the given entity type
+func (spec *IndexSpec) Index(t reflect.Type) *Index {
+	index := &Index{
+		Name:     spec.Name,
+		Unique:   spec.Unique,
+		Sparse:   spec.Sparse,
+		Encoding: spec.Encoding,
+		Scope:    spec.Scope,
+	}
+
+	for _, field := range spec.Fields {
+		name, kind := resolve(t, field)
+
+		index.Properties = append(index.Properties, name)
+		index.Types = append(index.Types, kind)
+		index.Normalizers = append(index.Normalizers, spec.Normalizers)
+		index.Each = append(index.Each, spec.Each)
+	}
+
+	return index
+}
+
+// resolve returns the datastore property name and the type of the Go field
+// path. The path is returned as it is with a nil type if it does not name a
+// field of the type.
+func resolve(t reflect.Type, path string) (string, reflect.Type) {
+	names := []string{}
+
+	for _, segment := range strings.Split(path, ".") {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return path, nil
+		}
+
+		field, ok := t.FieldByName(segment)
+		if !ok {
+			return path, nil
+		}
+
+		// the promoted fields of the anonymous structs are prefixed with the
+		// name of the struct only if it has one
+		for position := range field.Index {
+			current := t.FieldByIndex(field.Index[:position+1])
+
+			tags, err := structtag.Parse(string(current.Tag))
+			if err != nil {
+				tags = &structtag.Tags{}
+			}
+
+			if position < len(field.Index)-1 && !named(tags) {
+				continue
+			}
+
+			names = append(names, property(current, tags))
+		}
+
+		t = field.Type
+	}
+
+	return strings.Join(names, "."), t
+}
@@ -0,0 +1,105 @@
+package firestorm_test
+
+import (
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IndexSpec", func() {
+	var mapper *firestorm.IndexMapper
+
+	BeforeEach(func() {
+		mapper = &firestorm.IndexMapper{
+			Mutex: &sync.Mutex{},
+			Cache: make(map[reflect.Type]*firestorm.IndexTree),
+		}
+	})
+
+	It("registers the index of the type", func() {
+		mapper.Register(reflect.TypeOf(Order{}), firestorm.IndexSpec{
+			Name:   "external_ref",
+			Fields: []string{"Vendor", "ExternalID"},
+			Unique: true,
+		})
+
+		maptree := mapper.Tree(reflect.TypeOf(&Order{}))
+		Expect(maptree).NotTo(BeNil())
+
+		list := *maptree
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Name).To(Equal("external_ref"))
+		Expect(list[0].Unique).To(BeTrue())
+		Expect(list[0].Properties).To(Equal([]string{"Vendor", "ExternalID"}))
+
+		order := &Order{
+			ID:         datastore.NameKey("order", "007", nil),
+			Vendor:     "acme",
+			ExternalID: "A-42",
+		}
+
+		keys, err := maptree.Keys(order.ID, reflect.ValueOf(order))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0].Key.Kind).To(Equal("order_external_ref_index"))
+		Expect(keys[0].Values).To(Equal([]interface{}{"acme", "A-42"}))
+	})
+
+	Context("when the fields are nested", func() {
+		It("resolves the property names", func() {
+			mapper.Register(reflect.TypeOf(Company{}), firestorm.IndexSpec{
+				Name:   "zip",
+				Fields: []string{"Address.PostalCode", "Office.Country", "CreatedBy"},
+			})
+
+			list := *mapper.Tree(reflect.TypeOf(Company{}))
+			Expect(list).To(HaveLen(4))
+			Expect(list[3].Name).To(Equal("zip"))
+			Expect(list[3].Properties).To(Equal([]string{"address.postal_code", "office.country", "created_by"}))
+		})
+	})
+
+	Context("when the spec has the name of a tag index", func() {
+		It("overrides the tag index", func() {
+			Expect(*mapper.Tree(reflect.TypeOf(Entity{}))).To(HaveLen(1))
+
+			mapper.Register(reflect.TypeOf(&Entity{}), firestorm.IndexSpec{
+				Name:        "email",
+				Fields:      []string{"Email", "LastName"},
+				Normalizers: []string{"lower"},
+			})
+
+			list := *mapper.Tree(reflect.TypeOf(Entity{}))
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].Unique).To(BeFalse())
+			Expect(list[0].Properties).To(Equal([]string{"email", "last_name"}))
+			Expect(list[0].Normalizers).To(Equal([][]string{{"lower"}, {"lower"}}))
+		})
+	})
+
+	Context("when the type is a property list", func() {
+		It("registers the index of the properties", func() {
+			mapper.Register(reflect.TypeOf(datastore.PropertyList{}), firestorm.IndexSpec{
+				Name:   "email",
+				Fields: []string{"email"},
+				Unique: true,
+			})
+
+			entity := datastore.PropertyList{
+				{Name: "email", Value: "john@example.com"},
+			}
+
+			key := datastore.NameKey("entity", "007", nil)
+
+			keys, err := mapper.Tree(reflect.TypeOf(entity)).Keys(key, reflect.ValueOf(entity))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].Key.Name).To(Equal("14491862341308332741"))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package firestorm
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ErrIncompleteKey is returned when an incomplete key cannot be completed
+// because the entity does not implement datastore.KeyLoader
+var ErrIncompleteKey = errors.New("firestorm: incomplete key requires a datastore.KeyLoader entity")
+
+// Store saves the entities and maintains their indexes in the same transaction
+type Store struct {
+	Client *datastore.Client
+	Engine *Engine
+}
+
+// NewStore returns a new store for the given client that uses the default
+// engine
+func NewStore(client *datastore.Client) *Store {
+	return &Store{
+		Client: client,
+		Engine: engine,
+	}
+}
+
+// Get loads the entity stored for the key into dst
+func (s *Store) Get(ctx context.Context, key *datastore.Key, dst interface{}) error {
+	return s.Client.Get(ctx, key, dst)
+}
+
+// Insert inserts the entity and its indexes. It fails if the entity or any of
+// its unique indexes already exist.
+func (s *Store) Insert(ctx context.Context, key *datastore.Key, entity interface{}) (*datastore.Key, error) {
+	key, err := s.complete(ctx, key, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return s.Engine.NewInsertWriter(key, entity).Index(NewTransaction(tx))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Update updates an existing entity and its indexes
+func (s *Store) Update(ctx context.Context, key *datastore.Key, entity interface{}) error {
+	_, err := s.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return s.Engine.NewUpdateWriter(key, entity).Index(NewTransaction(tx))
+	})
+
+	return err
+}
+
+// Upsert inserts or updates the entity and its indexes
+func (s *Store) Upsert(ctx context.Context, key *datastore.Key, entity interface{}) (*datastore.Key, error) {
+	key, err := s.complete(ctx, key, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return s.Engine.NewUpsertWriter(key, entity).Index(NewTransaction(tx))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Delete deletes the entity and its indexes. The entity is used to load the
+// stored state of the entity, so it must be a pointer of the entity type.
+func (s *Store) Delete(ctx context.Context, key *datastore.Key, entity interface{}) error {
+	_, err := s.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return s.Engine.NewDeleteWriter(key, entity).Index(NewTransaction(tx))
+	})
+
+	return err
+}
+
+func (s *Store) complete(ctx context.Context, key *datastore.Key, entity interface{}) (*datastore.Key, error) {
+	if key == nil {
+		return nil, datastore.ErrInvalidKey
+	}
+
+	if !key.Incomplete() {
+		return key, nil
+	}
+
+	loader, ok := entity.(datastore.KeyLoader)
+	if !ok {
+		return nil, ErrIncompleteKey
+	}
+
+	completion := CompletionOf(s.Client, key)
+
+	if err := completion.LoadKey(ctx, loader); err != nil {
+		return nil, err
+	}
+
+	return completion.Key, nil
+}
@@ -0,0 +1,146 @@
+package firestorm_test
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		ctx    context.Context
+		entity *Entity
+		client *datastore.Client
+		store  *firestorm.Store
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entity = &Entity{
+			ID:        datastore.NameKey("entity", "007", nil),
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john@example.com",
+		}
+
+		var err error
+
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		store = firestorm.NewStore(client)
+	})
+
+	AfterEach(func() {
+		for _, kind := range []string{"entity", "entity_email_index"} {
+			query := datastore.NewQuery(kind).KeysOnly()
+
+			keys, err := client.GetAll(ctx, query, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.DeleteMulti(ctx, keys)).To(Succeed())
+		}
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	Describe("Insert", func() {
+		It("inserts the entity and its indexes", func() {
+			key, err := store.Insert(ctx, entity.ID, entity)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal(entity.ID))
+
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", entity.Email)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(entity.ID))
+
+			stored := &Entity{}
+			Expect(store.Get(ctx, key, stored)).To(Succeed())
+			Expect(stored).To(Equal(entity))
+		})
+
+		Context("when the key is incomplete", func() {
+			BeforeEach(func() {
+				entity.ID = datastore.IncompleteKey("entity", nil)
+			})
+
+			It("completes the key", func() {
+				key, err := store.Insert(ctx, entity.ID, entity)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key.Incomplete()).To(BeFalse())
+				Expect(entity.ID).To(Equal(key))
+			})
+		})
+
+		Context("when the unique index is taken", func() {
+			BeforeEach(func() {
+				_, err := store.Insert(ctx, entity.ID, entity)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				entity.ID = datastore.NameKey("entity", "008", nil)
+
+				_, err := store.Insert(ctx, entity.ID, entity)
+
+				conflict := &firestorm.IndexConflictError{}
+				Expect(errors.As(err, &conflict)).To(BeTrue())
+
+				stored := &Entity{}
+				Expect(store.Get(ctx, entity.ID, stored)).To(MatchError("datastore: no such entity"))
+			})
+		})
+	})
+
+	Describe("Update", func() {
+		BeforeEach(func() {
+			_, err := store.Insert(ctx, entity.ID, entity)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("updates the entity and its indexes", func() {
+			entity.Email = "jack@example.com"
+			Expect(store.Update(ctx, entity.ID, entity)).To(Succeed())
+
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", "jack@example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(entity.ID))
+
+			_, err = firestorm.LookupByIndex(ctx, client, "entity", "email", "john@example.com")
+			Expect(err).To(MatchError("datastore: no such entity"))
+		})
+	})
+
+	Describe("Upsert", func() {
+		It("inserts the entity and its indexes", func() {
+			key, err := store.Upsert(ctx, entity.ID, entity)
+			Expect(err).NotTo(HaveOccurred())
+
+			owner, err := firestorm.LookupByIndex(ctx, client, "entity", "email", entity.Email)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner).To(Equal(key))
+		})
+	})
+
+	Describe("Delete", func() {
+		BeforeEach(func() {
+			_, err := store.Insert(ctx, entity.ID, entity)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("deletes the entity and its indexes", func() {
+			Expect(store.Delete(ctx, entity.ID, &Entity{})).To(Succeed())
+
+			_, err := firestorm.LookupByIndex(ctx, client, "entity", "email", entity.Email)
+			Expect(err).To(MatchError("datastore: no such entity"))
+
+			stored := &Entity{}
+			Expect(store.Get(ctx, entity.ID, stored)).To(MatchError("datastore: no such entity"))
+		})
+	})
+})
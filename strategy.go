@@ -0,0 +1,139 @@
+package firestorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// KeyStrategy names the index entities
+type KeyStrategy interface {
+	// Kind returns the kind of the index entities of the entity kind and the
+	// index
+	Kind(kind, index string) string
+	// Name returns the key name of the index entity of the encoded value. The
+	// name must start with a prefix that depends only on the entity kind and
+	// the index, which is the name of the empty value.
+	Name(kind, index, value string) string
+}
+
+// KindKeyStrategy places the entities of every index in a dedicated kind
+// named <kind>_<index>_index. The key names are the encoded values.
+type KindKeyStrategy struct{}
+
+// Kind returns the kind of the index entities
+func (s *KindKeyStrategy) Kind(kind, index string) string {
+	return fmt.Sprintf("%s_%s_index", kind, index)
+}
+
+// Name returns the key name of the index entity
+func (s *KindKeyStrategy) Name(kind, index, value string) string {
+	return value
+}
+
+// SingleKindKeyStrategy places the entities of all indexes in a single kind.
+// The key names are composed of the entity kind, the index and the encoded
+// value.
+type SingleKindKeyStrategy struct {
+	// IndexKind is the kind of the index entities. It defaults to "index".
+	IndexKind string
+}
+
+// Kind returns the kind of the index entities
+func (s *SingleKindKeyStrategy) Kind(kind, index string) string {
+	if s.IndexKind == "" {
+		return "index"
+	}
+
+	return s.IndexKind
+}
+
+// Name returns the key name of the index entity
+func (s *SingleKindKeyStrategy) Name(kind, index, value string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, index, value)
+}
+
+// MigrateIndex moves the index entities of the entity kind and the index from
+// the keys constructed with the source options to the keys constructed with
+// the target options. The entities are read from the namespace of the source
+// options. The encoded values are kept as they are, so the options must not
+// differ in their encodings. The entities are moved page by page as they are
+// queried.
+func MigrateIndex(ctx context.Context, client *datastore.Client, kind, index string, from, to *KeyOptions) (int, error) {
+	var (
+		count  = 0
+		source = from.strategy()
+		prefix = source.Name(kind, index, "")
+	)
+
+	// every key is moved with two mutations
+	err := from.scan(ctx, client, kind, index, "", MaxMutations/2, func(keys []*datastore.Key) error {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			entities := make([]*IndexKey, len(keys))
+
+			if err := tx.GetMulti(keys, entities); err != nil {
+				return err
+			}
+
+			ops := []*datastore.Mutation{}
+
+			for position, key := range keys {
+				var (
+					entity = entities[position]
+					value  = key
+				)
+
+				// the non-unique index entities are children of the value
+				if isValueChild(key) {
+					value = key.Parent
+				}
+
+				next := &datastore.Key{
+					Kind:      to.Prefix + to.strategy().Kind(kind, index),
+					Name:      to.strategy().Name(kind, index, strings.TrimPrefix(value.Name, prefix)),
+					Namespace: to.namespace(value.Namespace),
+					Parent:    value.Parent,
+				}
+
+				// the scoped index entities stay in the namespace of the ancestor
+				if next.Parent != nil {
+					next.Namespace = next.Parent.Namespace
+				}
+
+				if value != key {
+					next = &datastore.Key{
+						Kind:      next.Kind,
+						Name:      key.Name,
+						Namespace: next.Namespace,
+						Parent:    next,
+					}
+				}
+
+				entity.Key = next
+
+				ops = append(ops, datastore.NewDelete(key))
+				ops = append(ops, datastore.NewUpsert(next, entity))
+			}
+
+			_, err := tx.Mutate(ops...)
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		count += len(keys)
+		return nil
+	})
+
+	return count, err
+}
+
+// isValueChild returns true for the entities of the non-unique indexes, which
+// are children of the value key of the same kind
+func isValueChild(key *datastore.Key) bool {
+	return key.Parent != nil && key.Parent.Kind == key.Kind
+}
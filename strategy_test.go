@@ -0,0 +1,100 @@
+package firestorm_test
+
+import (
+	"context"
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyStrategy", func() {
+	var (
+		entity  *Entity
+		options *firestorm.KeyOptions
+	)
+
+	BeforeEach(func() {
+		entity = &Entity{
+			ID:    datastore.NameKey("entity", "007", nil),
+			Email: "john@example.com",
+		}
+
+		options = &firestorm.KeyOptions{
+			Strategy: &firestorm.SingleKindKeyStrategy{},
+		}
+	})
+
+	keys := func(options *firestorm.KeyOptions) []*firestorm.IndexKey {
+		maptree := firestorm.DefaultEngine().Mapper.Tree(reflect.TypeOf(entity))
+
+		keys, err := maptree.KeysOf(entity.ID, reflect.ValueOf(entity), options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+		return keys
+	}
+
+	It("places the index entities in a single kind", func() {
+		key := keys(options)[0]
+		Expect(key.Key.Kind).To(Equal("index"))
+		Expect(key.Key.Name).To(Equal("entity/email/14491862341308332741"))
+	})
+
+	Context("when the index kind is set", func() {
+		It("uses the index kind", func() {
+			options.Prefix = "app_"
+			options.Strategy = &firestorm.SingleKindKeyStrategy{IndexKind: "lookup"}
+
+			key := keys(options)[0]
+			Expect(key.Key.Kind).To(Equal("app_lookup"))
+		})
+	})
+
+	Context("when the strategy is not set", func() {
+		It("places every index in its own kind", func() {
+			key := keys(&firestorm.KeyOptions{})[0]
+			Expect(key.Key.Kind).To(Equal("entity_email_index"))
+			Expect(key.Key.Name).To(Equal("14491862341308332741"))
+		})
+	})
+
+	Describe("MigrateIndex", func() {
+		var client *datastore.Client
+
+		BeforeEach(func() {
+			var err error
+
+			client, err = datastore.NewClient(context.TODO(), "foo-bar")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Put(context.TODO(), entity.ID, entity)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.RunInTransaction(context.TODO(), func(tx *datastore.Transaction) error {
+				return firestorm.NewInsertIndexer(entity.ID, entity).Index(firestorm.NewTransaction(tx))
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(client.Delete(context.TODO(), keys(options)[0].Key)).To(Succeed())
+			Expect(client.Delete(context.TODO(), entity.ID)).To(Succeed())
+		})
+
+		It("moves the index entities to the keys of the strategy", func() {
+			count, err := firestorm.MigrateIndex(context.TODO(), client, "entity", "email", &firestorm.KeyOptions{}, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(1))
+
+			index := &firestorm.IndexKey{}
+			Expect(client.Get(context.TODO(), keys(options)[0].Key, index)).To(Succeed())
+			Expect(index.Owner).To(Equal(entity.ID))
+
+			err = client.Get(context.TODO(), keys(&firestorm.KeyOptions{})[0].Key, index)
+			Expect(err).To(Equal(datastore.ErrNoSuchEntity))
+		})
+	})
+})
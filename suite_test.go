@@ -1,6 +1,7 @@
 package firestorm_test
 
 import (
+	"strings"
 	"testing"
 
 	"cloud.google.com/go/datastore"
@@ -32,3 +33,78 @@ func (p *Entity) Load(props []datastore.Property) error {
 func (p *Entity) Save() ([]datastore.Property, error) {
 	return datastore.SaveStruct(p)
 }
+
+type Employee struct {
+	ID      *datastore.Key `datastore:"__key__"`
+	Name    string         `datastore:"name"`
+	Company string         `datastore:"company" index:"company"`
+}
+
+type User struct {
+	ID    *datastore.Key `datastore:"__key__"`
+	Email string         `datastore:"email" index:"email,unique,lower,trim"`
+	Phone *string        `datastore:"phone" index:"phone,unique,sparse"`
+}
+
+type Product struct {
+	ID     *datastore.Key `datastore:"__key__"`
+	Vendor string         `datastore:"vendor" index:"sku,unique,encoding=canonical"`
+	SKU    int            `datastore:"sku" index:"sku"`
+}
+
+type Audit struct {
+	CreatedBy string `datastore:"created_by" index:"created_by"`
+}
+
+type Address struct {
+	Country    string `datastore:"country" index:"location"`
+	PostalCode string `datastore:"postal_code" index:"postal_code,unique"`
+}
+
+type Company struct {
+	Audit
+	ID      *datastore.Key `datastore:"__key__"`
+	Name    string         `datastore:"name" index:"location,unique"`
+	Address *Address       `datastore:"address,flatten"`
+	Office  Address        `datastore:"office"`
+}
+
+type Account struct {
+	ID      *datastore.Key `datastore:"__key__"`
+	Emails  []string       `datastore:"emails" index:"email,unique,each,lower"`
+	Aliases []string       `datastore:"aliases" index:"alias,unique,each"`
+}
+
+type Contact struct {
+	ID    *datastore.Key `datastore:"__key__"`
+	Email string         `datastore:"email" index:"email,unique"`
+}
+
+func (c *Contact) Load(props []datastore.Property) error {
+	return datastore.LoadStruct(c, props)
+}
+
+func (c *Contact) Save() ([]datastore.Property, error) {
+	return []datastore.Property{
+		{Name: "email", Value: strings.ToLower(c.Email)},
+	}, nil
+}
+
+type Order struct {
+	ID         *datastore.Key
+	Vendor     string
+	ExternalID string
+}
+
+type Project struct {
+	ID   *datastore.Key `datastore:"__key__"`
+	Name string         `datastore:"name" index:"name,unique,scope=parent"`
+	Code string         `datastore:"code" index:"code,unique,scope=root"`
+}
+
+type Score struct {
+	ID     *datastore.Key `datastore:"__key__"`
+	Rank   int32          `datastore:"rank" index:"rank,unique"`
+	Weight float32        `datastore:"weight" index:"weight,unique"`
+	Levels []int16        `datastore:"levels" index:"level,each"`
+}
@@ -0,0 +1,106 @@
+package firestorm_test
+
+import (
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Entity validation", func() {
+	var (
+		memory   *firestorm.Memory
+		entity   Entity
+		emailKey *datastore.Key
+	)
+
+	BeforeEach(func() {
+		memory = firestorm.NewMemory()
+
+		entity = Entity{
+			ID:    datastore.NameKey("entity", "007", nil),
+			Email: "john@example.com",
+		}
+
+		emailKey = datastore.NameKey("entity_email_index", "14491862341308332741", nil)
+	})
+
+	index := func(indexer firestorm.Indexer) error {
+		return memory.RunInTransaction(indexer.Index)
+	}
+
+	It("indexes a struct value", func() {
+		Expect(index(firestorm.NewInsertWriter(entity.ID, entity))).To(Succeed())
+		Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Succeed())
+
+		entity.Email = "jane@example.com"
+		Expect(index(firestorm.NewUpdateWriter(entity.ID, entity))).To(Succeed())
+		Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+	})
+
+	It("indexes a pointer to pointer", func() {
+		ptr := &entity
+		Expect(index(firestorm.NewInsertWriter(entity.ID, &ptr))).To(Succeed())
+		Expect(index(firestorm.NewUpsertIndexer(entity.ID, &ptr))).To(Succeed())
+		Expect(index(firestorm.NewDeleteWriter(entity.ID, &ptr))).To(Succeed())
+		Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+	})
+
+	It("indexes a property load saver", func() {
+		contact := &Contact{
+			ID:    datastore.NameKey("contact", "007", nil),
+			Email: "John@Example.com",
+		}
+
+		Expect(index(firestorm.NewInsertWriter(contact.ID, contact))).To(Succeed())
+		Expect(index(firestorm.NewDeleteWriter(contact.ID, Contact{}))).To(Succeed())
+	})
+
+	It("indexes a batch of mixed entities", func() {
+		other := &Entity{
+			ID:    datastore.NameKey("entity", "008", nil),
+			Email: "jane@example.com",
+		}
+
+		keys := []*datastore.Key{entity.ID, other.ID}
+		Expect(index(firestorm.NewBatchInsertIndexer(keys, []interface{}{entity, &other}))).To(Succeed())
+		Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Succeed())
+	})
+
+	Context("when the entity is not a struct", func() {
+		It("returns an error", func() {
+			err := index(firestorm.NewUpdateIndexer(entity.ID, "john@example.com"))
+			Expect(err).To(MatchError(firestorm.ErrInvalidEntity))
+			Expect(err).To(MatchError("firestorm: invalid entity: string is not a struct or a datastore.PropertyLoadSaver"))
+		})
+	})
+
+	Context("when the entity is nil", func() {
+		It("returns an error", func() {
+			var ptr *Entity
+
+			Expect(index(firestorm.NewInsertIndexer(entity.ID, nil))).To(MatchError(firestorm.ErrInvalidEntity))
+			Expect(index(firestorm.NewInsertIndexer(entity.ID, ptr))).To(MatchError("firestorm: invalid entity: nil *firestorm_test.Entity"))
+		})
+	})
+
+	Context("when a batch entity is invalid", func() {
+		It("returns an error", func() {
+			keys := []*datastore.Key{entity.ID}
+			err := index(firestorm.NewBatchUpdateIndexer(keys, []interface{}{42}))
+			Expect(err).To(MatchError(firestorm.ErrInvalidEntity))
+		})
+	})
+
+	Context("when the tree is nil", func() {
+		It("returns an error", func() {
+			var tree *firestorm.IndexTree
+
+			_, err := tree.Keys(entity.ID, reflect.ValueOf(42))
+			Expect(err).To(MatchError(firestorm.ErrInvalidEntity))
+		})
+	})
+})
@@ -0,0 +1,381 @@
+package firestorm
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// MaxLookups is the maximum number of keys of a single lookup
+const MaxLookups = 1000
+
+// IndexReport represents the result of an index verification
+type IndexReport struct {
+	// Kind is the kind of the verified entities
+	Kind string
+	// Entities is the number of the scanned entities
+	Entities int
+	// Missing are the index keys of the entities that are not stored
+	Missing []*IndexKey
+	// Orphaned are the stored index keys that no entity owns
+	Orphaned []*IndexKey
+	// Conflicting are the unique values of the entities that are owned by
+	// another entity
+	Conflicting []*IndexConflictError
+}
+
+// Healthy returns true if the report has no missing, orphaned or conflicting
+// index keys
+func (r *IndexReport) Healthy() bool {
+	return len(r.Missing) == 0 && len(r.Orphaned) == 0 && len(r.Conflicting) == 0
+}
+
+// Verify scans the entities of the kind and the entities of their indexes and
+// reports the missing, orphaned and conflicting index keys. The indexes are
+// defined by the type of the prototype.
+func (e *Engine) Verify(ctx context.Context, client *datastore.Client, kind string, prototype interface{}) (*IndexReport, error) {
+	kindOf, err := entityTypeOf(prototype)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tree   = e.Mapper.Tree(kindOf)
+		report = &IndexReport{Kind: kind}
+	)
+
+	if len(*tree) == 0 {
+		return report, nil
+	}
+
+	stored, err := e.stored(ctx, client, kind, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		owned = make(map[string]bool)
+		iter  = client.Run(ctx, datastore.NewQuery(kind))
+	)
+
+	for {
+		entity := reflect.New(kindOf)
+
+		key, err := iter.Next(entity.Interface())
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		report.Entities++
+
+		keys, err := tree.KeysOf(key, entity, &e.Options)
+		if conflict, ok := err.(*IndexConflictError); ok {
+			report.Conflicting = append(report.Conflicting, conflict)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			name := key.Key.Encode()
+
+			switch existing, ok := stored[name]; {
+			case !ok:
+				// the value is claimed by another missing key
+				if owned[name] {
+					report.Conflicting = append(report.Conflicting, conflict(key, nil))
+					continue
+				}
+
+				report.Missing = append(report.Missing, key)
+			case existing.Owner == nil || existing.Owner.Equal(key.Owner):
+				// the owner is unknown for the index keys of older versions
+			default:
+				report.Conflicting = append(report.Conflicting, conflict(key, existing.Owner))
+				continue
+			}
+
+			owned[name] = true
+		}
+	}
+
+	for _, index := range *tree {
+		for _, key := range stored {
+			if key.Index == index.Name && !owned[key.Key.Encode()] {
+				report.Orphaned = append(report.Orphaned, key)
+			}
+		}
+	}
+
+	// the stored keys are collected in a map, so they are sorted to keep the
+	// report stable
+	sort.Slice(report.Orphaned, func(i, j int) bool {
+		var (
+			left  = report.Orphaned[i].Key
+			right = report.Orphaned[j].Key
+		)
+
+		if left.Namespace != right.Namespace {
+			return left.Namespace < right.Namespace
+		}
+
+		return left.String() < right.String()
+	})
+
+	return report, nil
+}
+
+// stored returns the stored index keys of the indexes by key name
+func (e *Engine) stored(ctx context.Context, client *datastore.Client, kind string, tree *IndexTree) (map[string]*IndexKey, error) {
+	stored := make(map[string]*IndexKey)
+
+	for _, index := range *tree {
+		err := e.Options.scan(ctx, client, kind, index.Name, "", MaxLookups, func(keys []*datastore.Key) error {
+			chunk := make([]*IndexKey, len(keys))
+
+			if err := client.GetMulti(ctx, keys, chunk); err != nil {
+				return err
+			}
+
+			for position, key := range chunk {
+				key.Key = keys[position]
+				key.Index = index.Name
+				key.index = index
+				stored[key.Key.Encode()] = key
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stored, nil
+}
+
+// RepairOption configures a repair
+type RepairOption func(*RepairOptions)
+
+// RepairOptions represents the repair options
+type RepairOptions struct {
+	// DryRun reports the repairs without applying them
+	DryRun bool
+	// BatchSize is the number of the index keys repaired in a transaction
+	BatchSize int
+	// Progress is called after every repaired batch with the number of the
+	// repaired and all index keys
+	Progress func(done, total int)
+}
+
+// DryRun reports the repairs without applying them
+func DryRun() RepairOption {
+	return func(opts *RepairOptions) {
+		opts.DryRun = true
+	}
+}
+
+// BatchSize sets the number of the index keys repaired in a transaction
+func BatchSize(size int) RepairOption {
+	return func(opts *RepairOptions) {
+		opts.BatchSize = size
+	}
+}
+
+// OnProgress sets the progress callback of the repair
+func OnProgress(fn func(done, total int)) RepairOption {
+	return func(opts *RepairOptions) {
+		opts.Progress = fn
+	}
+}
+
+func repairOptionsOf(options []RepairOption) *RepairOptions {
+	opts := &RepairOptions{BatchSize: MaxMutations}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.BatchSize <= 0 || opts.BatchSize > MaxMutations {
+		opts.BatchSize = MaxMutations
+	}
+
+	return opts
+}
+
+// Repair verifies the indexes of the kind, inserts the missing index keys and
+// deletes the orphaned ones. Both are checked against the current state of
+// their owners before they are written. The conflicting values cannot be
+// repaired, so they are only reported. It returns the report of the verification.
+func (e *Engine) Repair(ctx context.Context, client *datastore.Client, kind string, prototype interface{}, options ...RepairOption) (*IndexReport, error) {
+	report, err := e.Verify(ctx, client, kind, prototype)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		opts    = repairOptionsOf(options)
+		pending = append(append([]*IndexKey{}, report.Missing...), report.Orphaned...)
+		total   = len(pending)
+		done    = 0
+		missing = len(report.Missing)
+	)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for len(pending) > 0 {
+		size := opts.BatchSize
+
+		if size > len(pending) {
+			size = len(pending)
+		}
+
+		var (
+			added   = []*IndexKey{}
+			removed = []*IndexKey{}
+		)
+
+		for position, key := range pending[:size] {
+			if done+position < missing {
+				added = append(added, key)
+			} else {
+				removed = append(removed, key)
+			}
+		}
+
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			// the owners may have changed their values since the verification
+			current, _, err := e.owned(tx, added, prototype)
+			if err != nil {
+				return err
+			}
+
+			ops, err := mutations(tx, IndexChangeset{&IndexChange{Added: current}})
+			if err != nil {
+				return err
+			}
+
+			_, orphans, err := e.owned(tx, removed, prototype)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range orphans {
+				ops = append(ops, datastore.NewDelete(key.Key))
+			}
+
+			if len(ops) == 0 {
+				return nil
+			}
+
+			_, err = tx.Mutate(ops...)
+			return err
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		done += size
+		pending = pending[size:]
+
+		if opts.Progress != nil {
+			opts.Progress(done, total)
+		}
+	}
+
+	return report, nil
+}
+
+// owned splits the index keys into the ones that their owners still own
+// within the transaction and the orphaned ones
+func (e *Engine) owned(tx Reader, keys []*IndexKey, prototype interface{}) ([]*IndexKey, []*IndexKey, error) {
+	kindOf, err := entityTypeOf(prototype)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		tree     = e.Mapper.Tree(kindOf)
+		owned    = []*IndexKey{}
+		orphaned = []*IndexKey{}
+		owners   = []*datastore.Key{}
+		claimed  = []*IndexKey{}
+	)
+
+	for _, key := range keys {
+		if key.Owner == nil {
+			orphaned = append(orphaned, key)
+			continue
+		}
+
+		owners = append(owners, key.Owner)
+		claimed = append(claimed, key)
+	}
+
+	if len(owners) == 0 {
+		return owned, orphaned, nil
+	}
+
+	var (
+		entities = make([]interface{}, len(owners))
+		errs     = make(datastore.MultiError, len(owners))
+	)
+
+	for position := range owners {
+		entities[position] = reflect.New(kindOf).Interface()
+	}
+
+	switch err := tx.GetMulti(owners, entities).(type) {
+	case nil:
+	case datastore.MultiError:
+		errs = err
+	default:
+		return nil, nil, err
+	}
+
+	for position, key := range claimed {
+		switch err := errs[position]; {
+		case err == datastore.ErrNoSuchEntity:
+			orphaned = append(orphaned, key)
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		current, err := tree.KeysOf(owners[position], reflect.ValueOf(entities[position]), &e.Options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if contains(current, key) {
+			owned = append(owned, key)
+		} else {
+			orphaned = append(orphaned, key)
+		}
+	}
+
+	return owned, orphaned, nil
+}
+
+func contains(keys []*IndexKey, key *IndexKey) bool {
+	for _, item := range keys {
+		if item.Key.Equal(key.Key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package firestorm_test
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IndexReport", func() {
+	It("is healthy without missing, orphaned or conflicting keys", func() {
+		report := &firestorm.IndexReport{Kind: "entity"}
+		Expect(report.Healthy()).To(BeTrue())
+
+		report.Orphaned = append(report.Orphaned, &firestorm.IndexKey{})
+		Expect(report.Healthy()).To(BeFalse())
+	})
+})
+
+var _ = Describe("Verify", func() {
+	var (
+		ctx    context.Context
+		entity *Entity
+		orphan *datastore.Key
+		client *datastore.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+
+		entity = &Entity{
+			ID:    datastore.NameKey("verified", "007", nil),
+			Email: "john@example.com",
+		}
+
+		orphan = datastore.NameKey("verified_email_index", "orphan", nil)
+
+		var err error
+		client, err = datastore.NewClient(ctx, "foo-bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Put(ctx, entity.ID, entity)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Put(ctx, orphan, &firestorm.IndexKey{
+			Owner: datastore.NameKey("verified", "008", nil),
+			Index: "email",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.DeleteMulti(ctx, []*datastore.Key{
+			entity.ID,
+			orphan,
+			datastore.NameKey("verified_email_index", "14491862341308332741", nil),
+		})).To(Succeed())
+
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("reports the missing and orphaned index keys", func() {
+		report, err := firestorm.Verify(ctx, client, "verified", entity)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Entities).To(Equal(1))
+		Expect(report.Missing).To(HaveLen(1))
+		Expect(report.Missing[0].Owner).To(Equal(entity.ID))
+		Expect(report.Orphaned).To(HaveLen(1))
+		Expect(report.Orphaned[0].Key).To(Equal(orphan))
+		Expect(report.Conflicting).To(BeEmpty())
+	})
+
+	Describe("Repair", func() {
+		It("repairs the index keys", func() {
+			calls := 0
+
+			report, err := firestorm.Repair(ctx, client, "verified", entity,
+				firestorm.BatchSize(1),
+				firestorm.OnProgress(func(done, total int) {
+					calls++
+					Expect(done).To(Equal(calls))
+					Expect(total).To(Equal(2))
+				}),
+			)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Healthy()).To(BeFalse())
+			Expect(calls).To(Equal(2))
+
+			report, err = firestorm.Verify(ctx, client, "verified", entity)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Healthy()).To(BeTrue())
+		})
+
+		Context("when the repair is a dry run", func() {
+			It("does not repair the index keys", func() {
+				_, err := firestorm.Repair(ctx, client, "verified", entity, firestorm.DryRun())
+				Expect(err).NotTo(HaveOccurred())
+
+				report, err := firestorm.Verify(ctx, client, "verified", entity)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.Healthy()).To(BeFalse())
+			})
+		})
+	})
+})
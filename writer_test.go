@@ -0,0 +1,80 @@
+package firestorm_test
+
+import (
+	"cloud.google.com/go/datastore"
+	"github.com/phogolabs/firestorm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		memory   *firestorm.Memory
+		entity   *Entity
+		emailKey *datastore.Key
+	)
+
+	BeforeEach(func() {
+		memory = firestorm.NewMemory()
+
+		entity = &Entity{
+			ID:    datastore.NameKey("entity", "007", nil),
+			Email: "john@example.com",
+		}
+
+		emailKey = datastore.NameKey("entity_email_index", "14491862341308332741", nil)
+	})
+
+	write := func(indexer firestorm.Indexer) error {
+		return memory.RunInTransaction(indexer.Index)
+	}
+
+	Describe("NewInsertWriter", func() {
+		It("inserts the entity and its indexes", func() {
+			Expect(write(firestorm.NewInsertWriter(entity.ID, entity))).To(Succeed())
+			Expect(memory.Get(entity.ID, &Entity{})).To(Succeed())
+			Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Succeed())
+		})
+
+		Context("when the entity exists", func() {
+			It("does not insert the indexes", func() {
+				Expect(write(firestorm.NewUpsertWriter(entity.ID, &Entity{ID: entity.ID}))).To(Succeed())
+
+				err := write(firestorm.NewInsertWriter(entity.ID, entity))
+				Expect(err).To(MatchError(firestorm.ErrEntityExists))
+				Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+			})
+		})
+	})
+
+	Describe("NewUpdateWriter", func() {
+		It("updates the entity and its indexes", func() {
+			Expect(write(firestorm.NewInsertWriter(entity.ID, entity))).To(Succeed())
+
+			entity.Email = "jane@example.com"
+			Expect(write(firestorm.NewUpdateWriter(entity.ID, entity))).To(Succeed())
+
+			stored := &Entity{}
+			Expect(memory.Get(entity.ID, stored)).To(Succeed())
+			Expect(stored.Email).To(Equal("jane@example.com"))
+			Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+
+		Context("when the entity does not exist", func() {
+			It("returns an error", func() {
+				err := write(firestorm.NewUpdateWriter(entity.ID, entity))
+				Expect(err).To(Equal(datastore.ErrNoSuchEntity))
+			})
+		})
+	})
+
+	Describe("NewDeleteWriter", func() {
+		It("deletes the entity and its indexes", func() {
+			Expect(write(firestorm.NewInsertWriter(entity.ID, entity))).To(Succeed())
+			Expect(write(firestorm.NewDeleteWriter(entity.ID, &Entity{}))).To(Succeed())
+			Expect(memory.Get(entity.ID, &Entity{})).To(Equal(datastore.ErrNoSuchEntity))
+			Expect(memory.Get(emailKey, &firestorm.IndexKey{})).To(Equal(datastore.ErrNoSuchEntity))
+		})
+	})
+})